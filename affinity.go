@@ -0,0 +1,113 @@
+package esl
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrUnknownChannel the channel is not seen by CHANNEL_CREATE
+var ErrUnknownChannel = errors.New("esl: unknown channel")
+
+// ChannelRegistry map each channel to the Inbound hosting it, built from the
+// CHANNEL_CREATE and CHANNEL_DESTROY events of the attached Inbounds
+// the zero value is ready to use
+type ChannelRegistry struct {
+	mu       sync.RWMutex
+	channels map[string]*Inbound
+}
+
+// Attach track the events of c in the order received and forget its channels
+// when disconnected, as the CHANNEL_DESTROY events are lost meanwhile
+// call it before c.Run, c must subscribe CHANNEL_CREATE and CHANNEL_DESTROY
+func (r *ChannelRegistry) Attach(c *Inbound) {
+	observe := c.Apps.observe
+	c.Apps.observe = func(msg *Message) {
+		if observe != nil {
+			observe(msg)
+		}
+		r.Track(c, msg)
+	}
+	onDisconnect := c.onDisconnect
+	c.onDisconnect = func() {
+		if onDisconnect != nil {
+			onDisconnect()
+		}
+		r.Forget(c)
+	}
+}
+
+// Track update the registry with an event received by c, other events than
+// CHANNEL_CREATE and CHANNEL_DESTROY are ignored
+// the events of a channel must be tracked in order, OnEvent runs each event in
+// its own goroutine so it is unsuitable, use Attach instead
+func (r *ChannelRegistry) Track(c *Inbound, msg *Message) {
+	var create bool
+	switch msg.Header.Get("Event-Name") {
+	case eventChannelCreate:
+		create = true
+	case eventChannelDestroy:
+	default:
+		return
+	}
+	uuid := msg.Header.Get("Unique-ID")
+	if uuid == "" {
+		return
+	}
+
+	r.mu.Lock()
+	if create {
+		if r.channels == nil {
+			r.channels = make(map[string]*Inbound)
+		}
+		r.channels[uuid] = c
+	} else {
+		delete(r.channels, uuid)
+	}
+	r.mu.Unlock()
+}
+
+// Lookup return the Inbound hosting the channel
+func (r *ChannelRegistry) Lookup(uuid string) (*Inbound, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.channels[uuid]
+	return c, ok
+}
+
+// Len return the number of tracked channels
+func (r *ChannelRegistry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.channels)
+}
+
+// Forget drop all channels of c, Attach does it when c is disconnected
+func (r *ChannelRegistry) Forget(c *Inbound) {
+	r.mu.Lock()
+	for uuid, owner := range r.channels {
+		if owner == c {
+			delete(r.channels, uuid)
+		}
+	}
+	r.mu.Unlock()
+}
+
+// ApiForUUID send "api <cmd> <uuid> <arg>" to the Inbound hosting the channel
+// e.g. ApiForUUID(uuid, "uuid_kill", "NORMAL_CLEARING")
+func (r *ChannelRegistry) ApiForUUID(uuid, cmd, arg string) (reply CommandReply) {
+	return r.ApiForUUIDContext(context.Background(), uuid, cmd, arg)
+}
+
+// ApiForUUIDContext is like ApiForUUID but with a context
+func (r *ChannelRegistry) ApiForUUIDContext(ctx context.Context, uuid, cmd, arg string) (reply CommandReply) {
+	c, ok := r.Lookup(uuid)
+	if !ok {
+		reply.err = ErrUnknownChannel
+		return
+	}
+	if arg != "" {
+		uuid += " " + arg
+	}
+	return c.ApiContext(ctx, cmd, uuid)
+}
@@ -0,0 +1,206 @@
+package esl
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func channelEvent(t *testing.T, name, uuid string) *Message {
+	msg, err := parseMessage(bufio.NewReader(strings.NewReader("Event-Name: " + name + "\nUnique-ID: " + uuid + "\n\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestChannelRegistry_ApiForUUID(t *testing.T) {
+	var (
+		inbounds []*Inbound
+		cmds     []chan string
+	)
+	for n := 0; n < 2; n++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		c := make(chan string, 16)
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			serveAuth(conn, c, make(chan struct{}))
+		}()
+		i := &Inbound{Address: l.Addr().String(), Password: "ClueCon"}
+		if err := i.Run(); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		defer i.Close()
+		inbounds = append(inbounds, i)
+		cmds = append(cmds, c)
+	}
+
+	var r ChannelRegistry
+	for n, uuid := range []string{"a1", "b2"} {
+		msg := channelEvent(t, eventChannelCreate, uuid)
+		r.Track(inbounds[n], msg)
+		ReleaseMessage(msg)
+	}
+	if r.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", r.Len())
+	}
+
+	reply := r.ApiForUUID("b2", "uuid_kill", "NORMAL_CLEARING")
+	if err := reply.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+	if got, want := <-cmds[1], "api uuid_kill b2 NORMAL_CLEARING"; got != want {
+		t.Errorf("command = %q, want %q", got, want)
+	}
+	if len(cmds[0]) != 0 {
+		t.Errorf("command sent to the wrong node")
+	}
+
+	msg := channelEvent(t, eventChannelDestroy, "b2")
+	r.Track(inbounds[1], msg)
+	ReleaseMessage(msg)
+	if reply := r.ApiForUUID("b2", "uuid_kill", ""); reply.Err() != ErrUnknownChannel {
+		t.Errorf("Err() = %v, want %v", reply.Err(), ErrUnknownChannel)
+	}
+
+	r.Forget(inbounds[0])
+	if _, ok := r.Lookup("a1"); ok {
+		t.Errorf("Lookup() found a forgotten channel")
+	}
+}
+
+func TestInboundCluster_forgetChannels(t *testing.T) {
+	var addrs []string
+	var ls []net.Listener
+	hangups := []chan struct{}{make(chan struct{}), make(chan struct{})}
+	for n := 0; n < 2; n++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		hangup := hangups[n]
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			serveAuth(conn, make(chan string, 16), hangup)
+		}()
+		addrs = append(addrs, l.Addr().String())
+		ls = append(ls, l)
+	}
+	defer close(hangups[0])
+
+	c := &InboundCluster{
+		Addresses:       addrs,
+		Password:        "ClueCon",
+		TrackChannels:   true,
+		MaxReconnect:    1,
+		ReconnectPolicy: &BackoffPolicy{Initial: time.Millisecond},
+	}
+	if err := c.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	defer c.Close()
+
+	nodes := c.Nodes()
+	for n, uuid := range []string{"a1", "b2"} {
+		msg := channelEvent(t, eventChannelCreate, uuid)
+		c.Channels().Track(nodes[n].Inbound, msg)
+		ReleaseMessage(msg)
+	}
+
+	// the second node is lost for good, its CHANNEL_DESTROY never arrives
+	_ = ls[1].Close()
+	close(hangups[1])
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := c.Channels().Lookup("b2"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the channels of the disconnected node are not forgotten")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if reply := c.ApiForUUID("b2", "uuid_kill", ""); reply.Err() != ErrUnknownChannel {
+		t.Errorf("Err() = %v, want %v", reply.Err(), ErrUnknownChannel)
+	}
+	if _, ok := c.Channels().Lookup("a1"); !ok {
+		t.Errorf("the channel of the healthy node is forgotten")
+	}
+}
+
+func TestChannelRegistry_Attach(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	const pairs = 2000
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		_, _ = conn.Write([]byte("Content-Type: auth/request\n\n"))
+		if _, err := readCommand(r); err != nil {
+			return
+		}
+		_, _ = conn.Write([]byte("Content-Type: command/reply\nReply-Text: +OK accepted\n\n"))
+
+		w := bufio.NewWriter(conn)
+		event := func(name, uuid string) {
+			payload := "Event-Name: " + name + "\nUnique-ID: " + uuid + "\n\n"
+			fmt.Fprintf(w, "Content-Length: %d\nContent-Type: text/event-plain\n\n%s", len(payload), payload)
+		}
+		for n := 0; n < pairs; n++ {
+			uuid := fmt.Sprintf("uuid-%d", n)
+			event(eventChannelCreate, uuid)
+			event(eventChannelDestroy, uuid)
+		}
+		event(eventChannelCreate, "last")
+		_ = w.Flush()
+		_, _ = readCommand(r)
+	}()
+
+	var registry ChannelRegistry
+	i := &Inbound{
+		Address:  l.Addr().String(),
+		Password: "ClueCon",
+		Apps:     Applications{OnEvent: func(msg *Message) {}},
+	}
+	registry.Attach(i)
+	if err := i.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	defer i.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := registry.Lookup("last"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the events are not tracked")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := registry.Len(); n != 1 {
+		t.Errorf("Len() = %d, want 1, destroyed channels are left", n)
+	}
+}
@@ -43,6 +43,21 @@ func (a *Args) AddBytes(key, value []byte) {
 	kv.value = append(kv.value[:0], value...)
 }
 
+// Del delete all values of the key
+func (a *Args) Del(key string) {
+	kvs := a.kvs[:0]
+	for _, kv := range a.kvs {
+		if key != string(kv.key) {
+			kvs = append(kvs, kv)
+		}
+	}
+	// the tail may alias the kept entries, it must not be reused by allocArg
+	for i := len(kvs); i < len(a.kvs); i++ {
+		a.kvs[i] = arg{}
+	}
+	a.kvs = kvs
+}
+
 func allocArg(h []arg) ([]arg, *arg) {
 	n := len(h)
 	if cap(h) > n {
@@ -92,3 +92,22 @@ func TestArgs_HeaderBytes(t *testing.T) {
 		})
 	}
 }
+
+func TestArgs_Del(t *testing.T) {
+	a := Args{kvs: []arg{
+		{key: []byte("key1"), value: []byte("value1")},
+		{key: []byte("key2"), value: []byte("value2")},
+		{key: []byte("key1"), value: []byte("value3")},
+	}}
+	a.Del("key1")
+	want := Args{kvs: []arg{
+		{key: []byte("key2"), value: []byte("value2")},
+	}}
+	if !reflect.DeepEqual(a, want) {
+		t.Errorf("Del() = %v, want %v", a, want)
+	}
+	a.Add("key3", "value4")
+	if got := string(a.GetBytes([]byte("key2"))); got != "value2" {
+		t.Errorf("GetBytes() = %v, want %v", got, "value2")
+	}
+}
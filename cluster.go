@@ -0,0 +1,366 @@
+package esl
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoHealthyNode all nodes of the cluster are disconnected
+var ErrNoHealthyNode = errors.New("esl: no healthy node")
+
+// Balance the strategy to pick a node for Api and Bgapi
+type Balance uint8
+
+const (
+	RoundRobin Balance = 1 + iota
+	// LeastSessions pick the node with the least Session-Count of HEARTBEAT
+	LeastSessions
+)
+
+func (b Balance) String() string {
+	switch b {
+	case RoundRobin:
+		return "round-robin"
+	case LeastSessions:
+		return "least-sessions"
+	default:
+		return "unknown"
+	}
+}
+
+// Node a FreeSWITCH node of InboundCluster
+type Node struct {
+	*Inbound
+
+	mu       sync.Mutex
+	started  bool
+	hostname string
+	coreUUID string
+	sessions int64
+}
+
+// Healthy report whether the node is connected and takes new commands
+func (n *Node) Healthy() bool {
+	n.mu.Lock()
+	started := n.started
+	n.mu.Unlock()
+	return started && n.Connected()
+}
+
+// Hostname FreeSWITCH-Hostname of the node, known after the first event
+func (n *Node) Hostname() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.hostname
+}
+
+// CoreUUID Core-UUID of the node, known after the first event
+func (n *Node) CoreUUID() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.coreUUID
+}
+
+// Sessions Session-Count of the latest HEARTBEAT
+func (n *Node) Sessions() int {
+	return int(atomic.LoadInt64(&n.sessions))
+}
+
+// observe learn the node identity and load from the event
+func (n *Node) observe(msg *Message) {
+	n.mu.Lock()
+	if v := msg.Header.Get("FreeSWITCH-Hostname"); v != "" {
+		n.hostname = v
+	}
+	if v := msg.Header.Get("Core-UUID"); v != "" {
+		n.coreUUID = v
+	}
+	n.mu.Unlock()
+	if msg.Header.Get("Event-Name") == eventHeartbeat {
+		if count, err := strconv.Atoi(msg.Header.Get("Session-Count")); err == nil {
+			atomic.StoreInt64(&n.sessions, int64(count))
+		}
+	}
+}
+
+// InboundCluster keep an Inbound connection to each FreeSWITCH node, merge
+// their events and dispatch Api and Bgapi to the healthy nodes
+// a disconnected node takes no new commands until it reconnects
+type InboundCluster struct {
+	// Addresses freeswitch esl addresses
+	// Required
+	Addresses []string
+	// Password freeswitch esl auth password
+	Password string
+	// User, Domain see Inbound
+	User   string
+	Domain string
+	// DialTimeout, KeepAlive, IdleTimeout, MaxReconnect, ReconnectPolicy
+	// see Inbound, they are applied to each node
+	DialTimeout     time.Duration
+	KeepAlive       time.Duration
+	IdleTimeout     time.Duration
+	MaxReconnect    int
+	ReconnectPolicy ReconnectPolicy
+	// Balance the strategy to pick a node for Api and Bgapi
+	// HEARTBEAT is subscribed on each node for LeastSessions
+	// Default: RoundRobin
+	Balance Balance
+	// TrackChannels subscribe CHANNEL_CREATE and CHANNEL_DESTROY on each node
+	// to route ApiForUUID to the node hosting the channel
+	TrackChannels bool
+	// OnEvent func called when an event message fetched from any node
+	OnEvent func(node *Node, msg *Message)
+	// OnReconnect func called after each reconnect attempt of a node
+	OnReconnect func(node *Node, status ReconnectStatus)
+
+	// internal
+	nodes    []*Node
+	next     uint32
+	channels ChannelRegistry
+	quit     chan struct{}
+}
+
+// Run connect to all nodes, the nodes failed to connect are retried in the
+// background, an error is returned only if none is connected
+func (c *InboundCluster) Run() error {
+	if len(c.Addresses) == 0 {
+		return errors.New("unset cluster addresses")
+	}
+	c.quit = make(chan struct{})
+	c.nodes = make([]*Node, len(c.Addresses))
+	for i, addr := range c.Addresses {
+		c.nodes[i] = c.newNode(addr)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		connected int
+		lastErr   error
+	)
+	for _, n := range c.nodes {
+		wg.Add(1)
+		go func(n *Node) {
+			defer wg.Done()
+			err := c.start(n)
+			mu.Lock()
+			if err == nil {
+				connected++
+			} else {
+				lastErr = err
+			}
+			mu.Unlock()
+			if err != nil {
+				logger.Printf("unable to connect to fs esl %s: %v", n.Address, err)
+				go c.retry(n)
+			}
+		}(n)
+	}
+	wg.Wait()
+
+	if connected == 0 {
+		c.Close()
+		return lastErr
+	}
+	return nil
+}
+
+func (c *InboundCluster) newNode(addr string) *Node {
+	n := &Node{}
+	n.Inbound = &Inbound{
+		Address:         addr,
+		Password:        c.Password,
+		User:            c.User,
+		Domain:          c.Domain,
+		DialTimeout:     c.DialTimeout,
+		KeepAlive:       c.KeepAlive,
+		IdleTimeout:     c.IdleTimeout,
+		MaxReconnect:    c.MaxReconnect,
+		ReconnectPolicy: c.ReconnectPolicy,
+		Apps: Applications{
+			OnEvent: func(msg *Message) {
+				if c.OnEvent != nil {
+					c.OnEvent(n, msg)
+				}
+			},
+			OnReconnect: func(_ *Inbound, status ReconnectStatus) {
+				if c.OnReconnect != nil {
+					c.OnReconnect(n, status)
+				}
+			},
+			observe: n.observe,
+		},
+	}
+	c.channels.Attach(n.Inbound)
+	return n
+}
+
+// start run the node and subscribe HEARTBEAT if needed
+func (c *InboundCluster) start(n *Node) error {
+	if err := n.Inbound.Run(); err != nil {
+		return err
+	}
+	var events []string
+	if c.Balance == LeastSessions {
+		events = append(events, eventHeartbeat)
+	}
+	if c.TrackChannels {
+		events = append(events, eventChannelCreate, eventChannelDestroy)
+	}
+	if len(events) > 0 {
+		reply := n.Event(EventPlain, strings.Join(events, " "))
+		if err := reply.Err(); err != nil {
+			logger.Printf("unable to subscribe %v on %s: %v", events, n.Address, err)
+		}
+	}
+	n.mu.Lock()
+	n.started = true
+	n.mu.Unlock()
+	return nil
+}
+
+// retry start the node until connected or the cluster is closed
+func (c *InboundCluster) retry(n *Node) {
+	policy := c.ReconnectPolicy
+	if policy == nil {
+		policy = DefaultReconnectPolicy
+	}
+	for attempt := 1; ; attempt++ {
+		t := time.NewTimer(policy.Delay(attempt))
+		select {
+		case <-t.C:
+		case <-c.quit:
+			t.Stop()
+			return
+		}
+		err := c.start(n)
+		if err == nil {
+			select {
+			case <-c.quit:
+				// closed while connecting
+				_ = n.Inbound.Close()
+			default:
+			}
+			return
+		}
+		if err == ErrAclDenied {
+			logger.Printf("stop connecting to fs esl %s: %v", n.Address, err)
+			return
+		}
+	}
+}
+
+// Nodes return all nodes of the cluster
+func (c *InboundCluster) Nodes() []*Node {
+	return append([]*Node(nil), c.nodes...)
+}
+
+// Pick return a healthy node according to Balance
+func (c *InboundCluster) Pick() (*Node, error) {
+	healthy := make([]*Node, 0, len(c.nodes))
+	for _, n := range c.nodes {
+		if n.Healthy() {
+			healthy = append(healthy, n)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil, ErrNoHealthyNode
+	}
+
+	if c.Balance == LeastSessions {
+		// Session-Count changes with HEARTBEAT only, the ties are broken
+		// round-robin so the calls between two heartbeats are spread
+		least := healthy[:0]
+		min := -1
+		for _, n := range healthy {
+			switch sessions := n.Sessions(); {
+			case min < 0 || sessions < min:
+				min = sessions
+				least = append(least[:0], n)
+			case sessions == min:
+				least = append(least, n)
+			}
+		}
+		healthy = least
+	}
+	i := atomic.AddUint32(&c.next, 1) - 1
+	return healthy[int(i%uint32(len(healthy)))], nil
+}
+
+// Api send a FreeSWITCH API command to a healthy node, blocking mode
+func (c *InboundCluster) Api(api, arg string) (reply CommandReply) {
+	return c.ApiContext(context.Background(), api, arg)
+}
+
+// ApiContext is like Api but with a context
+func (c *InboundCluster) ApiContext(ctx context.Context, api, arg string) (reply CommandReply) {
+	n, err := c.Pick()
+	if err != nil {
+		reply.err = err
+		return
+	}
+	return n.ApiContext(ctx, api, arg)
+}
+
+// Bgapi send a FreeSWITCH API command to a healthy node, non-blocking mode
+func (c *InboundCluster) Bgapi(app, arg string) (*Node, *Message, error) {
+	return c.BgapiContext(context.Background(), app, arg)
+}
+
+// BgapiContext is like Bgapi but with a context
+// the node is returned to match the BACKGROUND_JOB event
+func (c *InboundCluster) BgapiContext(ctx context.Context, app, arg string) (*Node, *Message, error) {
+	n, err := c.Pick()
+	if err != nil {
+		return nil, nil, err
+	}
+	msg, err := n.BgapiContext(ctx, app, arg)
+	return n, msg, err
+}
+
+// Channels return the channel registry of the cluster
+func (c *InboundCluster) Channels() *ChannelRegistry {
+	return &c.channels
+}
+
+// ApiForUUID send a uuid_* API command to the node hosting the channel
+// see ChannelRegistry.ApiForUUID
+func (c *InboundCluster) ApiForUUID(uuid, cmd, arg string) (reply CommandReply) {
+	return c.channels.ApiForUUIDContext(context.Background(), uuid, cmd, arg)
+}
+
+// ApiForUUIDContext is like ApiForUUID but with a context
+func (c *InboundCluster) ApiForUUIDContext(ctx context.Context, uuid, cmd, arg string) (reply CommandReply) {
+	return c.channels.ApiForUUIDContext(ctx, uuid, cmd, arg)
+}
+
+// Close close all nodes
+func (c *InboundCluster) Close() error {
+	if c.quit != nil {
+		select {
+		case <-c.quit:
+			return nil
+		default:
+			close(c.quit)
+		}
+	}
+	var err error
+	for _, n := range c.nodes {
+		n.mu.Lock()
+		started := n.started
+		n.mu.Unlock()
+		if !started {
+			continue
+		}
+		if e := n.Inbound.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,167 @@
+package esl
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNode_observe(t *testing.T) {
+	msg, err := parseMessage(bufio.NewReader(strings.NewReader("Event-Name: HEARTBEAT\nCore-UUID: 3d5a\nFreeSWITCH-Hostname: fs1\nSession-Count: 12\n\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReleaseMessage(msg)
+
+	n := &Node{}
+	n.observe(msg)
+	if got := n.Hostname(); got != "fs1" {
+		t.Errorf("Hostname() = %q, want %q", got, "fs1")
+	}
+	if got := n.CoreUUID(); got != "3d5a" {
+		t.Errorf("CoreUUID() = %q, want %q", got, "3d5a")
+	}
+	if got := n.Sessions(); got != 12 {
+		t.Errorf("Sessions() = %d, want %d", got, 12)
+	}
+}
+
+func TestInboundCluster_Api(t *testing.T) {
+	var (
+		addrs   []string
+		cmds    []chan string
+		hangups []chan struct{}
+		ls      []net.Listener
+	)
+	for n := 0; n < 2; n++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		c, hangup := make(chan string, 16), make(chan struct{})
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			serveAuth(conn, c, hangup)
+		}()
+		addrs = append(addrs, l.Addr().String())
+		cmds = append(cmds, c)
+		hangups = append(hangups, hangup)
+		ls = append(ls, l)
+	}
+
+	c := &InboundCluster{
+		Addresses:       addrs,
+		Password:        "ClueCon",
+		MaxReconnect:    1,
+		ReconnectPolicy: &BackoffPolicy{Initial: time.Millisecond},
+	}
+	if err := c.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	defer c.Close()
+
+	for n := 0; n < 4; n++ {
+		reply := c.Api("status", "")
+		if err := reply.Err(); err != nil {
+			t.Fatalf("Err() = %v", err)
+		}
+	}
+	if len(cmds[0]) != 2 || len(cmds[1]) != 2 {
+		t.Fatalf("dispatched = %d, %d, want 2, 2", len(cmds[0]), len(cmds[1]))
+	}
+	<-cmds[0]
+	<-cmds[0]
+	<-cmds[1]
+	<-cmds[1]
+
+	// the second node is drained once disconnected
+	_ = ls[1].Close()
+	close(hangups[1])
+	node := c.Nodes()[1]
+	deadline := time.Now().Add(5 * time.Second)
+	for node.Healthy() {
+		if time.Now().After(deadline) {
+			t.Fatal("the disconnected node is still healthy")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for n := 0; n < 2; n++ {
+		reply := c.Api("status", "")
+		if err := reply.Err(); err != nil {
+			t.Fatalf("Err() = %v", err)
+		}
+	}
+	if len(cmds[0]) != 2 {
+		t.Errorf("dispatched to the healthy node = %d, want 2", len(cmds[0]))
+	}
+
+	close(hangups[0])
+	_ = ls[0].Close()
+	for c.Nodes()[0].Healthy() {
+		time.Sleep(time.Millisecond)
+	}
+	if reply := c.Api("status", ""); reply.Err() != ErrNoHealthyNode {
+		t.Errorf("Err() = %v, want %v", reply.Err(), ErrNoHealthyNode)
+	}
+}
+
+func TestInboundCluster_PickLeastSessions(t *testing.T) {
+	var addrs []string
+	for n := 0; n < 3; n++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			serveAuth(conn, make(chan string, 16), make(chan struct{}))
+		}()
+		addrs = append(addrs, l.Addr().String())
+	}
+
+	c := &InboundCluster{Addresses: addrs, Password: "ClueCon", Balance: LeastSessions}
+	if err := c.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	defer c.Close()
+
+	nodes := c.Nodes()
+	heartbeat := func(n *Node, sessions string) {
+		msg, err := parseMessage(bufio.NewReader(strings.NewReader("Event-Name: HEARTBEAT\nSession-Count: " + sessions + "\n\n")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.observe(msg)
+		ReleaseMessage(msg)
+	}
+	heartbeat(nodes[0], "5")
+	heartbeat(nodes[1], "2")
+	heartbeat(nodes[2], "2")
+
+	picked := make(map[*Node]int)
+	for n := 0; n < 4; n++ {
+		node, err := c.Pick()
+		if err != nil {
+			t.Fatalf("Pick() error = %v", err)
+		}
+		picked[node]++
+	}
+	if picked[nodes[0]] != 0 || picked[nodes[1]] != 2 || picked[nodes[2]] != 2 {
+		t.Errorf("picked = %d, %d, %d, want 0, 2, 2", picked[nodes[0]], picked[nodes[1]], picked[nodes[2]])
+	}
+
+	heartbeat(nodes[0], "1")
+	if node, _ := c.Pick(); node != nodes[0] {
+		t.Errorf("Pick() = %s, want %s", node.Address, nodes[0].Address)
+	}
+}
@@ -8,11 +8,21 @@ import (
 var commandPool sync.Pool
 
 var (
-	strSendMsg = []byte("sendmsg")
-	strApi     = []byte("api")
-	strBgapi   = []byte("bgapi")
-	strEvent   = []byte("event")
-	strLFLF    = []byte("\n\n")
+	strSendMsg   = []byte("sendmsg")
+	strApi       = []byte("api")
+	strBgapi     = []byte("bgapi")
+	strEvent     = []byte("event")
+	strSendEvent = []byte("sendevent")
+	strLog       = []byte("log")
+	strNoLog     = []byte("nolog")
+	strFilter    = []byte("filter")
+	strMyEvents  = []byte("myevents")
+	strDivert    = []byte("divert_events")
+	strLinger    = []byte("linger")
+	strNoLinger  = []byte("nolinger")
+	strNixEvent  = []byte("nixevent")
+	strNoEvents  = []byte("noevents")
+	strLFLF      = []byte("\n\n")
 )
 
 const (
@@ -20,6 +30,14 @@ const (
 	msgApp     = "execute-app-name"
 	msgArg     = "execute-app-arg"
 	msgLoop    = "loops"
+
+	hdrJobUUID       = "Job-UUID"
+	hdrContentType   = "content-type"
+	hdrContentLength = "content-length"
+
+	// maxArgLength execute-app-arg must be shorter than this, otherwise it
+	// is sent as the message body
+	maxArgLength = 2048
 )
 
 type CommandType uint8
@@ -29,6 +47,16 @@ const (
 	ApiType
 	BgapiType
 	EventType
+	SendEventType
+	LogType
+	NoLogType
+	FilterType
+	MyEventsType
+	DivertEventsType
+	LingerType
+	NoLingerType
+	NixEventType
+	NoEventsType
 )
 
 func (c CommandType) String() string {
@@ -41,6 +69,48 @@ func (c CommandType) String() string {
 		return "bgapi"
 	case EventType:
 		return "event"
+	case SendEventType:
+		return "sendevent"
+	case LogType:
+		return "log"
+	case NoLogType:
+		return "nolog"
+	case FilterType:
+		return "filter"
+	case MyEventsType:
+		return "myevents"
+	case DivertEventsType:
+		return "divert_events"
+	case LingerType:
+		return "linger"
+	case NoLingerType:
+		return "nolinger"
+	case NixEventType:
+		return "nixevent"
+	case NoEventsType:
+		return "noevents"
+	default:
+		return "unknown"
+	}
+}
+
+// EventFormat the format of events delivered by FreeSWITCH
+type EventFormat uint8
+
+const (
+	EventPlain EventFormat = 1 + iota
+	EventJSON
+	EventXML
+)
+
+func (f EventFormat) String() string {
+	switch f {
+	case EventPlain:
+		return "plain"
+	case EventJSON:
+		return "json"
+	case EventXML:
+		return "xml"
 	default:
 		return "unknown"
 	}
@@ -50,8 +120,13 @@ func (c CommandType) String() string {
 type Command struct {
 	ct   CommandType
 	uuid []byte
+	name []byte
 	kvs  Args
+	body []byte
 	buf  []byte
+
+	// argBody send execute-app-arg as the message body
+	argBody bool
 }
 
 func AcquireCommand(t CommandType) *Command {
@@ -72,6 +147,9 @@ func releaseCommand(c *Command) {
 
 func (c *Command) reset() {
 	c.uuid = c.uuid[:0]
+	c.name = c.name[:0]
+	c.body = c.body[:0]
+	c.argBody = false
 	c.kvs.reset()
 }
 
@@ -106,7 +184,14 @@ func (c *Command) bgapi() []byte {
 	dst = append(dst, c.kvs.GetBytes([]byte(msgApp))...)
 	dst = append(dst, ' ')
 	dst = append(dst, c.kvs.GetBytes([]byte(msgArg))...)
-	dst = append(dst, strLFLF...)
+	dst = append(dst, '\n')
+	if id := c.kvs.GetBytes([]byte(hdrJobUUID)); len(id) > 0 {
+		dst = append(dst, hdrJobUUID...)
+		dst = append(dst, strColonSpace...)
+		dst = append(dst, id...)
+		dst = append(dst, '\n')
+	}
+	dst = append(dst, '\n')
 
 	c.buf = dst
 	return c.buf
@@ -125,15 +210,44 @@ func (c *Command) event() []byte {
 	return c.buf
 }
 
-// TODO: send event
+// line generate a single line command with an optional arg
+func (c *Command) line(name []byte) []byte {
+	var dst []byte
+
+	dst = append(c.buf[:0], name...)
+	if arg := c.kvs.GetBytes([]byte(msgArg)); len(arg) > 0 {
+		dst = append(dst, ' ')
+		dst = append(dst, arg...)
+	}
+	dst = append(dst, strLFLF...)
+
+	c.buf = dst
+	return c.buf
+}
+
+// sendEvent generate the sendevent command
 // https://freeswitch.org/confluence/display/FREESWITCH/mod_event_socket#mod_event_socket-3.8sendevent
 func (c *Command) sendEvent() []byte {
+	var dst []byte
+
+	dst = append(c.buf[:0], strSendEvent...)
+	dst = append(dst, ' ')
+	dst = append(dst, c.name...)
+	dst = append(dst, '\n')
+	if len(c.body) > 0 {
+		c.kvs.Set(hdrContentLength, strconv.Itoa(len(c.body)))
+	}
+	dst = c.kvs.AppendBytes(dst)
+	dst = append(dst, c.body...)
+
+	c.buf = dst
 	return c.buf
 }
 
 // message generate message
 // https://freeswitch.org/confluence/display/FREESWITCH/mod_event_socket#mod_event_socket-3.9sendmsg
 // Outbound doesn't need uuid
+// execute-app-arg is sent as a text/plain body if it is too long or SetArgBody is called
 func (c *Command) message() []byte {
 	var dst []byte
 
@@ -143,7 +257,18 @@ func (c *Command) message() []byte {
 		dst = append(dst, c.uuid...)
 	}
 	dst = append(dst, '\n')
+	if arg := c.kvs.GetBytes([]byte(msgArg)); arg != nil && (c.argBody || len(arg) >= maxArgLength) {
+		c.body = append(c.body[:0], arg...)
+		c.kvs.Del(msgArg)
+	}
+	if len(c.body) > 0 {
+		if c.kvs.GetBytes([]byte(hdrContentType)) == nil {
+			c.kvs.Add(hdrContentType, "text/plain")
+		}
+		c.kvs.Set(hdrContentLength, strconv.Itoa(len(c.body)))
+	}
 	dst = c.kvs.AppendBytes(dst)
+	dst = append(dst, c.body...)
 
 	c.buf = dst
 	return c.buf
@@ -159,6 +284,26 @@ func (c *Command) Bytes() []byte {
 		return c.bgapi()
 	case EventType:
 		return c.event()
+	case SendEventType:
+		return c.sendEvent()
+	case LogType:
+		return c.line(strLog)
+	case NoLogType:
+		return c.line(strNoLog)
+	case FilterType:
+		return c.line(strFilter)
+	case MyEventsType:
+		return c.line(strMyEvents)
+	case DivertEventsType:
+		return c.line(strDivert)
+	case LingerType:
+		return c.line(strLinger)
+	case NoLingerType:
+		return c.line(strNoLinger)
+	case NixEventType:
+		return c.line(strNixEvent)
+	case NoEventsType:
+		return c.line(strNoEvents)
 	default:
 		return nil
 	}
@@ -171,13 +316,28 @@ func (c *Command) SetUUID(id string) *Command {
 	return c
 }
 
+// SetEventName set the event name for sendevent
+// e.g. NOTIFY, PRESENCE_IN, SEND_MESSAGE, CUSTOM
+func (c *Command) SetEventName(name string) *Command {
+	c.name = append(c.name[:0], name...)
+	return c
+}
+
+// SetBody set the command body
+// the content-length header is generated automatically
+func (c *Command) SetBody(body string) *Command {
+	c.body = append(c.body[:0], body...)
+	return c
+}
+
 // SetCommand set command
 // available command:
-//   execute: invoke dialplan applications
-//   hangup: hang up the call
-//   unicast: hook up mod_spandsp for faxing over a socket
-//   nomedia:
-//   xferext:
+//
+//	execute: invoke dialplan applications
+//	hangup: hang up the call
+//	unicast: hook up mod_spandsp for faxing over a socket
+//	nomedia:
+//	xferext:
 func (c *Command) SetCommand(cmd string) *Command {
 	c.kvs.Add(msgCommand, cmd)
 	return c
@@ -190,8 +350,7 @@ func (c *Command) SetApp(app string) *Command {
 }
 
 // SetArg set the dialplan application data
-// arg must be shorter than 2048 bytes
-// TODO: body support
+// for sendmsg, arg longer than 2048 bytes is sent as the message body
 func (c *Command) SetArg(arg string) *Command {
 	if arg == "" {
 		return c
@@ -200,6 +359,18 @@ func (c *Command) SetArg(arg string) *Command {
 	return c
 }
 
+// SetArgBody set the dialplan application data, always sent as the message body
+func (c *Command) SetArgBody(arg string) *Command {
+	c.argBody = true
+	return c.SetArg(arg)
+}
+
+// SetJobUUID set the Job-UUID of bgapi instead of the one generated by FreeSWITCH
+func (c *Command) SetJobUUID(id string) *Command {
+	c.kvs.Set(hdrJobUUID, id)
+	return c
+}
+
 // SetLoops set number of times to invoke the command, default: 1
 func (c *Command) SetLoops(n int) *Command {
 	c.kvs.Add(msgLoop, strconv.Itoa(n))
@@ -2,6 +2,7 @@ package esl
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -85,3 +86,105 @@ func TestCommand_Api(t *testing.T) {
 		})
 	}
 }
+
+func TestCommand_SendEvent(t *testing.T) {
+	type fields struct {
+		name []byte
+		kvs  Args
+		body []byte
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		want   []byte
+	}{
+		{
+			name: "without body",
+			fields: fields{
+				name: []byte("CUSTOM"),
+				kvs: Args{kvs: []arg{
+					{key: []byte("Event-Subclass"), value: []byte("myevent::notify")},
+				}},
+			},
+			want: []byte("sendevent CUSTOM\nEvent-Subclass: myevent::notify\n\n"),
+		},
+		{
+			name: "with body",
+			fields: fields{
+				name: []byte("NOTIFY"),
+				kvs: Args{kvs: []arg{
+					{key: []byte("profile"), value: []byte("internal")},
+					{key: []byte("content-type"), value: []byte("application/simple-message-summary")},
+				}},
+				body: []byte("Messages-Waiting: yes\n"),
+			},
+			want: []byte("sendevent NOTIFY\nprofile: internal\ncontent-type: application/simple-message-summary\ncontent-length: 22\n\nMessages-Waiting: yes\n"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Command{
+				name: tt.fields.name,
+				kvs:  tt.fields.kvs,
+				body: tt.fields.body,
+			}
+			if got := c.sendEvent(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sendEvent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommand_MessageBody(t *testing.T) {
+	long := strings.Repeat("a", maxArgLength)
+	tests := []struct {
+		name string
+		cmd  *Command
+		want []byte
+	}{
+		{
+			name: "short arg",
+			cmd:  (&Command{}).SetCommand("execute").SetApp("set").SetArg("foo=bar"),
+			want: []byte("sendmsg\ncall-command: execute\nexecute-app-name: set\nexecute-app-arg: foo=bar\n\n"),
+		},
+		{
+			name: "arg body",
+			cmd:  (&Command{}).SetCommand("execute").SetApp("set").SetArgBody("foo=bar"),
+			want: []byte("sendmsg\ncall-command: execute\nexecute-app-name: set\ncontent-type: text/plain\ncontent-length: 7\n\nfoo=bar"),
+		},
+		{
+			name: "long arg",
+			cmd:  (&Command{}).SetCommand("execute").SetApp("speak").SetArg(long),
+			want: []byte("sendmsg\ncall-command: execute\nexecute-app-name: speak\ncontent-type: text/plain\ncontent-length: 2048\n\n" + long),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cmd.message(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("message() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommand_Line(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  *Command
+		want []byte
+	}{
+		{name: "log", cmd: AcquireCommand(LogType).SetArg("7"), want: []byte("log 7\n\n")},
+		{name: "nolog", cmd: AcquireCommand(NoLogType), want: []byte("nolog\n\n")},
+		{name: "filter", cmd: AcquireCommand(FilterType).SetArg("Event-Name CHANNEL_CREATE"), want: []byte("filter Event-Name CHANNEL_CREATE\n\n")},
+		{name: "myevents", cmd: AcquireCommand(MyEventsType).SetArg("json"), want: []byte("myevents json\n\n")},
+		{name: "linger", cmd: AcquireCommand(LingerType), want: []byte("linger\n\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cmd.Bytes(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Bytes() = %q, want %q", got, tt.want)
+			}
+			releaseCommand(tt.cmd)
+		})
+	}
+}
@@ -2,17 +2,34 @@ package esl
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Applications struct {
-	// OnReconnect func called when reconnecting
-	OnReconnect func(c *Inbound, err error)
+	// OnReconnect func called after each reconnect attempt
+	// status.Err is ErrAclDenied if rejected by acl, no more reconnect is attempted
+	OnReconnect func(c *Inbound, status ReconnectStatus)
 	// OnEvent func called when an event message fetched
 	OnEvent func(msg *Message)
+	// OnLog func called when a log/data message fetched, it is called on the
+	// reader goroutine so the records keep the order of the console
+	// it must not block or wait for a command reply of the connection, hand
+	// the record over to another goroutine for slow work
+	// See Connection.Log
+	OnLog func(rec *LogRecord)
+
+	// observe called on the reader goroutine before OnEvent, so the events
+	// are seen in order, e.g. the bookkeeping of ChannelRegistry
+	observe func(msg *Message)
 }
 
 type connectionType uint8
@@ -24,6 +41,9 @@ const (
 
 var connectionPool sync.Pool
 
+// ErrDisconnected the connection is lost before the request completes
+var ErrDisconnected = errors.New("esl: connection disconnected")
+
 type Connection struct {
 	apps *Applications
 
@@ -31,61 +51,137 @@ type Connection struct {
 	ct   connectionType
 	r    *bufio.Reader
 
-	mu sync.Mutex
-
-	channelData      *Message
-	commandReplyChan chan *Message
+	// wsem serializes writing the commands, so the order of pending is the
+	// order on the wire, the replies are waited without holding it
+	wsem chan struct{}
+	// qmu protects pending and the connection state below
+	qmu     sync.Mutex
+	pending []*request
+	// online the socket is authenticated, commands can be written
+	online bool
+	// gen incremented each time the connection goes online
+	gen uint64
+	// connected ready for the commands of the callers, the session is restored
+	connected bool
+	closed    bool
+	// ready closed when connected or closed, created by the queued commands
+	ready chan struct{}
+	// queueing block the commands issued while disconnected until connected,
+	// otherwise they fail with ErrDisconnected
+	queueing bool
+
+	// idleTimeout the read deadline of each message, 0 means no deadline
+	idleTimeout time.Duration
+	// lastRead unix nano of the last message received, accessed atomically
+	lastRead int64
+
+	// smu protects the session state below, it is restored after reconnecting
+	smu      sync.Mutex
+	filters  []Filter
+	sub      Subscription
+	logLevel int
+	logging  bool
+	myevents []myEvents
+
+	// jmu protects jobs and execs
+	jmu   sync.Mutex
+	jobs  map[string]*BgapiJob
+	execs map[string]chan *Message
+
+	channelData *Message
+	// captures the named captures of the OutboundMux route
+	captures map[string]string
+
+	// ctx canceled on hangup or when the connection is closed for good
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func acquireConnection(conn net.Conn, t connectionType) *Connection {
-	got := connectionPool.Get()
-	if got == nil {
-		return &Connection{
-			conn:             conn,
-			ct:               t,
-			r:                bufio.NewReader(conn),
-			commandReplyChan: make(chan *Message, 1),
+	var o *Connection
+	if got := connectionPool.Get(); got == nil {
+		o = &Connection{
+			conn: conn,
+			ct:   t,
+			r:    bufio.NewReader(conn),
+			wsem: make(chan struct{}, 1),
 		}
+	} else {
+		o = got.(*Connection)
+		o.reset(conn)
+		o.qmu.Lock()
+		o.closed = false
+		o.qmu.Unlock()
+		o.clearSession()
+		o.captures = nil
 	}
-	o := got.(*Connection)
-	o.reset(conn)
+	o.ctx, o.cancel = context.WithCancel(context.Background())
 	return o
 }
 
+// releaseOutbound put the connection back to the pool, both the reader and
+// the handler must be finished
 func releaseOutbound(o *Connection) {
+	o.cancel()
 	connectionPool.Put(o)
 }
 
+// reset switch to the new socket, the closed state set by Close is kept
 func (c *Connection) reset(conn net.Conn) {
+	c.qmu.Lock()
 	c.conn = conn
+	c.qmu.Unlock()
 	c.r.Reset(conn)
-	c.channelData.reset()
+	if c.channelData != nil {
+		c.channelData.reset()
+	}
 }
 
 func (c *Connection) waitMessage() {
+	defer c.setDisconnected()
+	if c.ct == outbound {
+		// the outbound socket is never reconnected
+		defer c.cancel()
+	}
 	for {
+		if c.idleTimeout > 0 {
+			_ = c.conn.SetReadDeadline(time.Now().Add(c.idleTimeout))
+		}
 		msg, err := parseMessage(c.r)
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				logger.Printf("no message received in %s, the connection is dead", c.idleTimeout)
+				break
+			}
 			logger.Printf("unable to parse message: %v", err)
 			break
 		}
+		atomic.StoreInt64(&c.lastRead, time.Now().UnixNano())
 		ct := msg.ContentType()
 		switch ct {
 		case commandReply:
 			c.produceReply(msg)
 		case apiResponse:
 			c.produceReply(msg)
-		case eventPlain:
-			if c.apps.OnEvent != nil {
-				go func(msg *Message) {
-					c.apps.OnEvent(msg.payload())
-					ReleaseMessage(msg)
-				}(msg)
-			}
+		case eventPlain, eventJSON, eventXML:
+			c.handleEvent(msg)
+		case logData:
+			c.handleLog(msg)
 		case disconnectNotice:
+			linger := msg.Header.Get("Content-Disposition") == "linger"
+			ReleaseMessage(msg)
+			if c.ct == outbound {
+				// the channel is hung up
+				c.cancel()
+			}
+			if linger {
+				// the events after hangup keep coming until FreeSWITCH
+				// closes the socket
+				continue
+			}
 			return
 		default:
 			logger.Printf("unhandled content type: %s", ct)
@@ -94,12 +190,74 @@ func (c *Connection) waitMessage() {
 	}
 }
 
+// handleEvent parse the event payload and pass it to OnEvent
+func (c *Connection) handleEvent(msg *Message) {
+	if _, err := msg.event(); err != nil {
+		logger.Printf("unable to parse %s event: %v", msg.ContentType(), err)
+		ReleaseMessage(msg)
+		return
+	}
+	switch msg.Header.Get("Event-Name") {
+	case eventBackgroundJob:
+		c.resolveJob(msg)
+	case eventExecuteComplete:
+		c.resolveExec(msg)
+	}
+	if c.apps.observe != nil {
+		c.apps.observe(msg)
+	}
+	if c.apps.OnEvent == nil {
+		ReleaseMessage(msg)
+		return
+	}
+	go func(msg *Message) {
+		c.apps.OnEvent(msg)
+		ReleaseMessage(msg)
+	}(msg)
+}
+
+// handleLog parse the log record and pass it to OnLog in order
+func (c *Connection) handleLog(msg *Message) {
+	if c.apps.OnLog == nil {
+		ReleaseMessage(msg)
+		return
+	}
+	rec := parseLogRecord(msg)
+	ReleaseMessage(msg)
+	c.apps.OnLog(rec)
+}
+
 func parseMessage(r *bufio.Reader) (*Message, error) {
 	e := acquireMessage()
 	err := e.parse(r)
 	return e, err
 }
 
+// Done closed when the channel is hung up or the connection is closed for
+// good, e.g. the outbound socket is lost or Inbound is closed
+func (c *Connection) Done() <-chan struct{} {
+	return c.ctx.Done()
+}
+
+// Context canceled when Done is closed, e.g. to bound the calls of a handler
+func (c *Connection) Context() context.Context {
+	return c.ctx
+}
+
+// channelUUID the Unique-ID of the outbound channel
+func (c *Connection) channelUUID() string {
+	if c.channelData == nil {
+		return ""
+	}
+	return c.channelData.Header.Get("Unique-ID")
+}
+
+// Capture return the named capture of the OutboundMux route, e.g. "ext" of
+// the pattern "800{ext}"
+func (c *Connection) Capture(name string) string {
+	return c.captures[name]
+}
+
 // Info CHANNEL_DATA event after connected
 func (c *Connection) Info() *Message {
 	return c.channelData
@@ -119,123 +277,533 @@ func (c *Connection) connect() error {
 	return nil
 }
 
-func (c *Connection) produceReply(msg *Message) {
-	c.commandReplyChan <- msg
+// request a command waiting for its reply
+type request struct {
+	// reply closed if disconnected before the reply arrives
+	reply chan *Message
+}
+
+// Connected report whether the connection is ready for commands
+func (c *Connection) Connected() bool {
+	c.qmu.Lock()
+	defer c.qmu.Unlock()
+	return c.connected
+}
+
+// setConnected mark the connection ready for commands
+func (c *Connection) setConnected() {
+	c.qmu.Lock()
+	c.online = true
+	c.gen++
+	c.connected = true
+	c.wakeLocked()
+	c.qmu.Unlock()
+}
+
+// setOnline mark the connection ready for writing the commands, but the
+// commands of the callers wait until promote
+func (c *Connection) setOnline() uint64 {
+	c.qmu.Lock()
+	defer c.qmu.Unlock()
+	c.online = true
+	c.gen++
+	return c.gen
+}
+
+// promote mark the connection ready for commands, if it is still online
+// since setOnline returned gen
+func (c *Connection) promote(gen uint64) bool {
+	c.qmu.Lock()
+	defer c.qmu.Unlock()
+	if !c.online || c.gen != gen {
+		return false
+	}
+	c.connected = true
+	c.wakeLocked()
+	return true
+}
+
+// setDisconnected fail all requests waiting for a reply or an event
+func (c *Connection) setDisconnected() {
+	c.qmu.Lock()
+	c.online = false
+	c.connected = false
+	pending := c.pending
+	c.pending = nil
+	c.qmu.Unlock()
+
+	for _, req := range pending {
+		close(req.reply)
+	}
+	c.failJobs(ErrDisconnected)
+}
+
+// shutdown mark the connection closed, the queued commands fail
+func (c *Connection) shutdown() {
+	c.qmu.Lock()
+	c.closed = true
+	c.wakeLocked()
+	c.qmu.Unlock()
+	c.cancel()
+}
+
+func (c *Connection) wakeLocked() {
+	if c.ready != nil {
+		close(c.ready)
+		c.ready = nil
+	}
 }
 
-func (c *Connection) waitReply() *Message {
-	return <-c.commandReplyChan
+// waitReady wait until connected if queueing is enabled
+func (c *Connection) waitReady(ctx context.Context) error {
+	c.qmu.Lock()
+	defer c.qmu.Unlock()
+	for !c.connected {
+		if c.closed || !c.queueing {
+			return ErrDisconnected
+		}
+		if c.ready == nil {
+			c.ready = make(chan struct{})
+		}
+		ready := c.ready
+		c.qmu.Unlock()
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			c.qmu.Lock()
+			return ctx.Err()
+		}
+		c.qmu.Lock()
+	}
+	return nil
 }
 
-func (c *Connection) send(cmd *Command) error {
+// produceReply pass the reply to the oldest pending request
+// the replies are sent by FreeSWITCH in the order of the commands
+func (c *Connection) produceReply(msg *Message) {
+	c.qmu.Lock()
+	if len(c.pending) == 0 {
+		c.qmu.Unlock()
+		logger.Printf("unexpected reply: %s", msg.Header.Get("Reply-Text"))
+		ReleaseMessage(msg)
+		return
+	}
+	req := c.pending[0]
+	c.pending[0] = nil
+	c.pending = c.pending[1:]
+	c.qmu.Unlock()
+
+	// never blocks, the reply of an abandoned request is dropped
+	req.reply <- msg
+}
+
+// send write the command and queue the request for the reply
+func (c *Connection) send(ctx context.Context, cmd *Command) (*request, error) {
 	buf := cmd.Bytes()
 	if buf == nil {
-		return fmt.Errorf("invalid command type: %s", cmd.ct)
+		return nil, fmt.Errorf("invalid command type: %s", cmd.ct)
+	}
+
+	select {
+	case c.wsem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	_, err := c.conn.Write(buf)
-	return err
+	defer func() { <-c.wsem }()
+
+	req := &request{reply: make(chan *Message, 1)}
+	c.qmu.Lock()
+	if !c.online {
+		c.qmu.Unlock()
+		return nil, ErrDisconnected
+	}
+	conn := c.conn
+	c.pending = append(c.pending, req)
+	c.qmu.Unlock()
+
+	if d, ok := ctx.Deadline(); ok {
+		_ = conn.SetWriteDeadline(d)
+		defer conn.SetWriteDeadline(time.Time{})
+	}
+	if _, err := conn.Write(buf); err != nil {
+		c.qmu.Lock()
+		if n := len(c.pending); n > 0 && c.pending[n-1] == req {
+			c.pending = c.pending[:n-1]
+		}
+		c.qmu.Unlock()
+		// the command may be partially written, the stream can't be trusted
+		_ = conn.Close()
+		return nil, err
+	}
+	return req, nil
 }
 
 func (c *Connection) Command(cmd *Command) (reply CommandReply) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	err := c.send(cmd)
+	return c.CommandContext(context.Background(), cmd)
+}
+
+// CommandContext send the command and wait for the reply
+// the commands of concurrent callers are pipelined, each reply is matched to
+// its command in order
+// ctx.Err() is returned if ctx is done before the reply arrives, the late
+// reply is dropped
+// ErrDisconnected is returned if the connection is lost before the reply arrives
+func (c *Connection) CommandContext(ctx context.Context, cmd *Command) (reply CommandReply) {
+	if err := c.waitReady(ctx); err != nil {
+		reply.err = err
+		return
+	}
+	return c.roundTrip(ctx, cmd)
+}
+
+// roundTrip send the command and wait for the reply without waiting for ready
+func (c *Connection) roundTrip(ctx context.Context, cmd *Command) (reply CommandReply) {
+	req, err := c.send(ctx, cmd)
 	if err != nil {
 		reply.err = err
 		return
 	}
 
-	reply.Message = c.waitReply()
+	select {
+	case msg, ok := <-req.reply:
+		if !ok {
+			reply.err = ErrDisconnected
+			return
+		}
+		reply.Message = msg
+	case <-ctx.Done():
+		reply.err = ctx.Err()
+	}
+	return
+}
+
+// do send a pooled command and wait for the reply, cmd is released after sent
+func (c *Connection) do(ctx context.Context, cmd *Command) (reply CommandReply) {
+	reply = c.CommandContext(ctx, cmd)
+	releaseCommand(cmd)
 	return
 }
 
 // Execute send a command to FreeSWITCH
+// arg longer than 2048 bytes is sent as the message body
 func (c *Connection) Execute(app, arg string) (reply CommandReply) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	cmd := AcquireCommand(MessageType).
+	return c.ExecuteContext(context.Background(), app, arg)
+}
+
+// ExecuteContext is like Execute but with a context
+func (c *Connection) ExecuteContext(ctx context.Context, app, arg string) (reply CommandReply) {
+	return c.do(ctx, AcquireCommand(MessageType).
 		SetCommand("execute").
 		SetApp(app).
-		SetArg(arg)
-	err := c.send(cmd)
-	releaseCommand(cmd)
-	if err != nil {
-		reply.err = err
-		return
+		SetArg(arg))
+}
+
+// ExecuteAndWait send a command to FreeSWITCH and wait for the application
+// to complete, return Application-Response and the CHANNEL_EXECUTE_COMPLETE event
+// the event must be subscribed, e.g. by Outbound.MyEvents
+func (c *Connection) ExecuteAndWait(app, arg string) (string, *Message, error) {
+	return c.ExecuteAndWaitContext(context.Background(), app, arg)
+}
+
+// ExecuteAndWaitContext is like ExecuteAndWait but with a context
+func (c *Connection) ExecuteAndWaitContext(ctx context.Context, app, arg string) (string, *Message, error) {
+	id := newUUID()
+	// register before sending, the event may arrive before the reply is handled
+	ch := c.addExec(id)
+	defer c.removeExec(id)
+	reply := c.do(ctx, AcquireCommand(MessageType).
+		SetCommand("execute").
+		SetApp(app).
+		SetArg(arg).
+		SetHeader("Event-UUID", id).
+		SetHeader("event-lock", "true"))
+	if err := reply.Err(); err != nil {
+		return "", nil, err
 	}
 
-	reply.Message = c.waitReply()
-	return
+	select {
+	case event, ok := <-ch:
+		if !ok {
+			return "", nil, ErrDisconnected
+		}
+		return event.Header.Get("Application-Response"), event, nil
+	case <-ctx.Done():
+		return "", nil, ctx.Err()
+	}
 }
 
 // Api send a FreeSWITCH API command, blocking mode
 func (c *Connection) Api(api, arg string) (reply CommandReply) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	cmd := AcquireCommand(ApiType).SetApp(api).SetArg(arg)
-	err := c.send(cmd)
-	releaseCommand(cmd)
-	if err != nil {
-		reply.err = err
-		return
-	}
+	return c.ApiContext(context.Background(), api, arg)
+}
 
-	reply.Message = c.waitReply()
-	return
+// ApiContext is like Api but with a context
+func (c *Connection) ApiContext(ctx context.Context, api, arg string) (reply CommandReply) {
+	return c.do(ctx, AcquireCommand(ApiType).SetApp(api).SetArg(arg))
 }
 
 // Bgapi send a FreeSWITCH API command, non-blocking mode
 // return job id
 func (c *Connection) Bgapi(app, arg string) (*Message, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	cmd := AcquireCommand(BgapiType).SetApp(app).SetArg(arg)
-	err := c.send(cmd)
-	releaseCommand(cmd)
-	if err != nil {
+	return c.BgapiContext(context.Background(), app, arg)
+}
+
+// BgapiContext is like Bgapi but with a context
+func (c *Connection) BgapiContext(ctx context.Context, app, arg string) (*Message, error) {
+	reply := c.do(ctx, AcquireCommand(BgapiType).SetApp(app).SetArg(arg))
+	return reply.Message, reply.err
+}
+
+// BgapiJob send a FreeSWITCH API command in background, the job is resolved
+// by the matching BACKGROUND_JOB event, which must be subscribed by Event
+// jobID is sent as Job-UUID, a random one is generated if empty
+func (c *Connection) BgapiJob(app, arg, jobID string) (*BgapiJob, error) {
+	return c.BgapiJobContext(context.Background(), app, arg, jobID)
+}
+
+// BgapiJobContext is like BgapiJob but with a context, ctx only covers
+// sending the command, see BgapiJob.WaitContext for waiting the result
+func (c *Connection) BgapiJobContext(ctx context.Context, app, arg, jobID string) (*BgapiJob, error) {
+	if jobID == "" {
+		jobID = newUUID()
+	}
+	// register before sending, the event may arrive before the reply is handled
+	job := c.addJob(jobID)
+	reply := c.do(ctx, AcquireCommand(BgapiType).SetApp(app).SetArg(arg).SetJobUUID(jobID))
+	if err := reply.Err(); err != nil {
+		c.removeJob(jobID)
 		return nil, err
 	}
-
-	msg := c.waitReply()
-	return msg, nil
+	return job, nil
 }
 
 // Event send a FreeSWITCH event command
-func (c *Connection) Event(arg string) (reply CommandReply) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	cmd := AcquireCommand(EventType).SetArg(arg)
-	err := c.send(cmd)
-	releaseCommand(cmd)
-	if err != nil {
-		reply.err = err
-		return
+// events: space separated event names, e.g. "CHANNEL_HANGUP_COMPLETE HEARTBEAT"
+// CUSTOM subclasses follow CUSTOM, e.g. "CUSTOM sofia::register"
+func (c *Connection) Event(format EventFormat, events string) (reply CommandReply) {
+	return c.EventContext(context.Background(), format, events)
+}
+
+// EventContext is like Event but with a context
+func (c *Connection) EventContext(ctx context.Context, format EventFormat, events string) (reply CommandReply) {
+	reply = c.do(ctx, AcquireCommand(EventType).SetArg(format.String()+" "+events))
+	if reply.Err() == nil {
+		c.smu.Lock()
+		c.sub.Format = format
+		c.sub.add(strings.Fields(events))
+		c.smu.Unlock()
+	}
+	return
+}
+
+// NixEvent unsubscribe the events previously subscribed by Event, or exclude
+// them from ALL
+func (c *Connection) NixEvent(names ...string) (reply CommandReply) {
+	return c.NixEventContext(context.Background(), names...)
+}
+
+// NixEventContext is like NixEvent but with a context
+func (c *Connection) NixEventContext(ctx context.Context, names ...string) (reply CommandReply) {
+	reply = c.do(ctx, AcquireCommand(NixEventType).SetArg(strings.Join(names, " ")))
+	if reply.Err() == nil {
+		c.smu.Lock()
+		c.sub.remove(names)
+		c.smu.Unlock()
 	}
+	return
+}
+
+// NoEvents unsubscribe all events
+func (c *Connection) NoEvents() (reply CommandReply) {
+	return c.NoEventsContext(context.Background())
+}
 
-	reply.Message = c.waitReply()
+// NoEventsContext is like NoEvents but with a context
+func (c *Connection) NoEventsContext(ctx context.Context) (reply CommandReply) {
+	reply = c.do(ctx, AcquireCommand(NoEventsType))
+	if reply.Err() == nil {
+		c.smu.Lock()
+		c.sub = Subscription{}
+		c.smu.Unlock()
+	}
 	return
 }
 
+// SendEvent send an event into FreeSWITCH
+// headers and body are optional
+// e.g. c.SendEvent("CUSTOM", headers, "") with an Event-Subclass header
+func (c *Connection) SendEvent(name string, headers *Args, body string) (reply CommandReply) {
+	return c.SendEventContext(context.Background(), name, headers, body)
+}
+
+// SendEventContext is like SendEvent but with a context
+func (c *Connection) SendEventContext(ctx context.Context, name string, headers *Args, body string) (reply CommandReply) {
+	cmd := AcquireCommand(SendEventType).SetEventName(name).SetBody(body)
+	if headers != nil {
+		for i, n := 0, len(headers.kvs); i < n; i++ {
+			kv := &headers.kvs[i]
+			cmd.kvs.AddBytes(kv.key, kv.value)
+		}
+	}
+	return c.do(ctx, cmd)
+}
+
+// Log enable log output, the log lines are passed to Applications.OnLog
+// level: 0 (CONSOLE) - 7 (DEBUG)
+func (c *Connection) Log(level int) (reply CommandReply) {
+	return c.LogContext(context.Background(), level)
+}
+
+// LogContext is like Log but with a context
+func (c *Connection) LogContext(ctx context.Context, level int) (reply CommandReply) {
+	reply = c.do(ctx, AcquireCommand(LogType).SetArg(strconv.Itoa(level)))
+	if reply.Err() == nil {
+		c.smu.Lock()
+		c.logLevel, c.logging = level, true
+		c.smu.Unlock()
+	}
+	return
+}
+
+// NoLog disable log output previously enabled by Log
+func (c *Connection) NoLog() (reply CommandReply) {
+	return c.NoLogContext(context.Background())
+}
+
+// NoLogContext is like NoLog but with a context
+func (c *Connection) NoLogContext(ctx context.Context) (reply CommandReply) {
+	reply = c.do(ctx, AcquireCommand(NoLogType))
+	if reply.Err() == nil {
+		c.smu.Lock()
+		c.logging = false
+		c.smu.Unlock()
+	}
+	return
+}
+
+// Filter only receive the events whose header matches the value
+// filters of the same header are ORed, filters of different headers are ANDed
+func (c *Connection) Filter(header, value string) (reply CommandReply) {
+	return c.FilterContext(context.Background(), header, value)
+}
+
+// FilterContext is like Filter but with a context
+func (c *Connection) FilterContext(ctx context.Context, header, value string) (reply CommandReply) {
+	reply = c.do(ctx, AcquireCommand(FilterType).SetArg(header+" "+value))
+	if reply.Err() == nil {
+		c.addFilter(Filter{Header: header, Value: value})
+	}
+	return
+}
+
+// FilterDelete delete the filter previously added by Filter
+// if value is empty, all filters of the header are deleted
+func (c *Connection) FilterDelete(header, value string) (reply CommandReply) {
+	return c.FilterDeleteContext(context.Background(), header, value)
+}
+
+// FilterDeleteContext is like FilterDelete but with a context
+func (c *Connection) FilterDeleteContext(ctx context.Context, header, value string) (reply CommandReply) {
+	arg := "delete " + header
+	if value != "" {
+		arg += " " + value
+	}
+	reply = c.do(ctx, AcquireCommand(FilterType).SetArg(arg))
+	if reply.Err() == nil {
+		c.deleteFilter(header, value)
+	}
+	return
+}
+
+// FilterDeleteAll delete all filters
+func (c *Connection) FilterDeleteAll() (reply CommandReply) {
+	return c.FilterDeleteAllContext(context.Background())
+}
+
+// FilterDeleteAllContext is like FilterDeleteAll but with a context
+func (c *Connection) FilterDeleteAllContext(ctx context.Context) (reply CommandReply) {
+	reply = c.do(ctx, AcquireCommand(FilterType).SetArg("delete all"))
+	if reply.Err() == nil {
+		c.deleteFilter("", "")
+	}
+	return
+}
+
+// MyEvents subscribe to all events of a channel
+// Outbound doesn't need uuid, the controlled channel is used
+func (c *Connection) MyEvents(format EventFormat, uuid string) (reply CommandReply) {
+	return c.MyEventsContext(context.Background(), format, uuid)
+}
+
+// MyEventsContext is like MyEvents but with a context
+func (c *Connection) MyEventsContext(ctx context.Context, format EventFormat, uuid string) (reply CommandReply) {
+	reply = c.do(ctx, myEvents{format: format, uuid: uuid}.command())
+	if reply.Err() == nil {
+		c.addMyEvents(myEvents{format: format, uuid: uuid})
+	}
+	return
+}
+
+// DivertEvents redirect the events of input callbacks (e.g. DTMF in playback)
+// to the socket
+func (c *Connection) DivertEvents(on bool) (reply CommandReply) {
+	return c.DivertEventsContext(context.Background(), on)
+}
+
+// DivertEventsContext is like DivertEvents but with a context
+func (c *Connection) DivertEventsContext(ctx context.Context, on bool) (reply CommandReply) {
+	arg := "off"
+	if on {
+		arg = "on"
+	}
+	return c.do(ctx, AcquireCommand(DivertEventsType).SetArg(arg))
+}
+
+// Linger keep the socket open after the channel hangs up, so the remaining
+// events can be received
+// d is rounded to seconds, 0 means FreeSWITCH default
+func (c *Connection) Linger(d time.Duration) (reply CommandReply) {
+	return c.LingerContext(context.Background(), d)
+}
+
+// LingerContext is like Linger but with a context
+func (c *Connection) LingerContext(ctx context.Context, d time.Duration) (reply CommandReply) {
+	cmd := AcquireCommand(LingerType)
+	if secs := int(d / time.Second); secs > 0 {
+		cmd.SetArg(strconv.Itoa(secs))
+	}
+	return c.do(ctx, cmd)
+}
+
+// NoLinger disable linger
+func (c *Connection) NoLinger() (reply CommandReply) {
+	return c.NoLingerContext(context.Background())
+}
+
+// NoLingerContext is like NoLinger but with a context
+func (c *Connection) NoLingerContext(ctx context.Context) (reply CommandReply) {
+	return c.do(ctx, AcquireCommand(NoLingerType))
+}
+
 // Hangup Hangs up a channel
 // cause: https://freeswitch.org/confluence/display/FREESWITCH/Hangup+Cause+Code+Table
 func (c *Connection) Hangup(cause string) (reply CommandReply) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	return c.HangupContext(context.Background(), cause)
+}
+
+// HangupContext is like Hangup but with a context
+func (c *Connection) HangupContext(ctx context.Context, cause string) (reply CommandReply) {
 	cmd := AcquireCommand(MessageType).SetCommand("hangup")
 	if cause != "" {
 		cmd.SetHeader("hangup-cause", cause)
 	}
-	err := c.send(cmd)
-	releaseCommand(cmd)
-	if err != nil {
-		reply.err = err
-		return
-	}
-
-	reply.Message = c.waitReply()
-	return
+	return c.do(ctx, cmd)
 }
 
 func (c *Connection) Close() error {
-	return c.conn.Close()
+	c.shutdown()
+	c.qmu.Lock()
+	conn := c.conn
+	c.qmu.Unlock()
+	return conn.Close()
 }
@@ -0,0 +1,204 @@
+package esl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConnection_CommandContext(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		r := bufio.NewReader(server)
+		// the first command is never replied in time
+		if _, err := readCommand(r); err != nil {
+			return
+		}
+		if _, err := readCommand(r); err != nil {
+			return
+		}
+		_, _ = fmt.Fprint(server, "Content-Type: api/response\nContent-Length: 6\n\nlate\n\n")
+		_, _ = fmt.Fprint(server, "Content-Type: api/response\nContent-Length: 7\n\n+OK 1\n\n")
+	}()
+
+	c := acquireConnection(client, inbound)
+	c.apps = &Applications{}
+	c.setConnected()
+	go c.waitMessage()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	reply := c.ApiContext(ctx, "status", "")
+	if err := reply.Err(); err != context.DeadlineExceeded {
+		t.Fatalf("ApiContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	reply = c.Api("show", "calls count")
+	if err := reply.Err(); err != nil {
+		t.Fatalf("Api() error = %v", err)
+	}
+	if got := string(reply.Body()); got != "+OK 1\n\n" {
+		t.Errorf("Api() = %q, want %q", got, "+OK 1\n\n")
+	}
+}
+
+// readCommand read a command without body sent by the client
+func readCommand(r *bufio.Reader) (string, error) {
+	var cmd []byte
+	for {
+		line, err := r.ReadSlice('\n')
+		if err != nil {
+			return "", err
+		}
+		if len(line) == 1 {
+			return string(cmd), nil
+		}
+		cmd = append(cmd, line...)
+	}
+}
+
+func TestConnection_Disconnected(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		r := bufio.NewReader(server)
+		if _, err := readCommand(r); err != nil {
+			return
+		}
+		// hang up without reply
+		_ = server.Close()
+	}()
+
+	c := acquireConnection(client, inbound)
+	c.apps = &Applications{}
+	c.setConnected()
+	go c.waitMessage()
+
+	reply := c.Api("status", "")
+	if err := reply.Err(); err != ErrDisconnected {
+		t.Fatalf("Api() error = %v, want %v", err, ErrDisconnected)
+	}
+	reply = c.Api("status", "")
+	if err := reply.Err(); err != ErrDisconnected {
+		t.Fatalf("Api() error = %v, want %v", err, ErrDisconnected)
+	}
+
+	c.queueing = true
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	reply = c.ApiContext(ctx, "status", "")
+	if err := reply.Err(); err != context.DeadlineExceeded {
+		t.Fatalf("ApiContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// serveEcho reply each api command with its arg after latency, the commands
+// are read without waiting for the replies, like FreeSWITCH does
+func serveEcho(conn net.Conn, latency time.Duration) {
+	type job struct {
+		at  time.Time
+		arg string
+	}
+	jobs := make(chan job, 1024)
+	go func() {
+		defer close(jobs)
+		r := bufio.NewReader(conn)
+		for {
+			cmd, err := readCommand(r)
+			if err != nil {
+				return
+			}
+			jobs <- job{at: time.Now().Add(latency), arg: strings.TrimPrefix(strings.TrimSpace(cmd), "api echo ")}
+		}
+	}()
+	for j := range jobs {
+		time.Sleep(time.Until(j.at))
+		if _, err := fmt.Fprintf(conn, "Content-Type: api/response\nContent-Length: %d\n\n%s", len(j.arg), j.arg); err != nil {
+			return
+		}
+	}
+}
+
+func newEchoConnection(tb testing.TB, latency time.Duration) *Connection {
+	client, server := net.Pipe()
+	tb.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+	go serveEcho(server, latency)
+
+	c := acquireConnection(client, inbound)
+	c.apps = &Applications{}
+	c.setConnected()
+	go c.waitMessage()
+	return c
+}
+
+func TestConnection_Pipelined(t *testing.T) {
+	c := newEchoConnection(t, time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			want := "+OK " + strconv.Itoa(i)
+			reply := c.Api("echo", want)
+			if err := reply.Err(); err != nil {
+				t.Errorf("Api() error = %v", err)
+				return
+			}
+			if got := string(reply.Body()); got != want {
+				t.Errorf("Api() = %v, want %v", got, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// BenchmarkConnection_ApiSerialized one api round-trip at a time, as if
+// guarded by a global mutex
+func BenchmarkConnection_ApiSerialized(b *testing.B) {
+	c := newEchoConnection(b, time.Millisecond)
+	var mu sync.Mutex
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			mu.Lock()
+			reply := c.Api("echo", "+OK")
+			mu.Unlock()
+			if err := reply.Err(); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkConnection_ApiPipelined concurrent api commands pipelined on one
+// connection
+func BenchmarkConnection_ApiPipelined(b *testing.B) {
+	c := newEchoConnection(b, time.Millisecond)
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			reply := c.Api("echo", "+OK")
+			if err := reply.Err(); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
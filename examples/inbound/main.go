@@ -11,15 +11,14 @@ func main() {
 		Address:  "192.168.40.249:8021",
 		Password: "ClueCon",
 		Apps: esl.Applications{
-			OnReconnect: func(c *esl.Inbound, err error) {
-				if err != nil {
-					fmt.Println("reconnect failed:", err)
+			OnReconnect: func(c *esl.Inbound, status esl.ReconnectStatus) {
+				if status.Err != nil {
+					fmt.Println("reconnect failed:", status.Err, "retry in", status.Delay)
 					return
 				}
-				// do something after reconnected...
-				reply := c.Event("CHANNEL_HANGUP_COMPLETE HEARTBEAT")
-				if err := reply.Err(); err != nil {
-					panic(err)
+				// events, filters and log level are restored before OnReconnect
+				if status.RestoreErr != nil {
+					fmt.Println("restore failed:", status.RestoreErr)
 				}
 			},
 			OnEvent: func(msg *esl.Message) {
@@ -43,7 +42,7 @@ func main() {
 	}
 	defer inbound.Close()
 
-	reply := inbound.Event("CHANNEL_HANGUP_COMPLETE HEARTBEAT")
+	reply := inbound.Event(esl.EventPlain, "CHANNEL_HANGUP_COMPLETE HEARTBEAT")
 	if err := reply.Err(); err != nil {
 		panic(err)
 	}
@@ -7,21 +7,21 @@ import (
 
 func main() {
 	outbound := esl.Outbound{
-		Handler: func(conn *esl.Connection) {
+		// the channel is hung up if the handler fails
+		HangupOnError: true,
+		HandlerFunc: func(conn *esl.Connection) error {
 			fmt.Println("new connection")
 			fmt.Println(string(conn.Info().Bytes()))
 			reply := conn.Execute("answer", "")
 			if err := reply.Err(); err != nil {
-				panic(err)
+				return err
 			}
 			reply = conn.Execute("info", "")
 			if err := reply.Err(); err != nil {
-				panic(err)
+				return err
 			}
 			reply = conn.Hangup("NORMAL_CLEARING")
-			if err := reply.Err(); err != nil {
-				panic(err)
-			}
+			return reply.Err()
 		},
 	}
 	if err := outbound.Serve(); err != nil {
@@ -0,0 +1,41 @@
+package esl
+
+// Filter an event filter applied by Connection.Filter
+type Filter struct {
+	Header string
+	Value  string
+}
+
+// Filters return the active filters of the connection
+// Inbound re-applies them after reconnected
+func (c *Connection) Filters() []Filter {
+	c.smu.Lock()
+	defer c.smu.Unlock()
+	return append([]Filter(nil), c.filters...)
+}
+
+func (c *Connection) addFilter(f Filter) {
+	c.smu.Lock()
+	defer c.smu.Unlock()
+	for _, v := range c.filters {
+		if v == f {
+			return
+		}
+	}
+	c.filters = append(c.filters, f)
+}
+
+// deleteFilter delete the matching filters
+// empty value matches all filters of the header, empty header matches all filters
+func (c *Connection) deleteFilter(header, value string) {
+	c.smu.Lock()
+	defer c.smu.Unlock()
+	filters := c.filters[:0]
+	for _, f := range c.filters {
+		if header == "" || (f.Header == header && (value == "" || f.Value == value)) {
+			continue
+		}
+		filters = append(filters, f)
+	}
+	c.filters = filters
+}
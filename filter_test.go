@@ -0,0 +1,51 @@
+package esl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConnection_deleteFilter(t *testing.T) {
+	filters := []Filter{
+		{Header: "Event-Name", Value: "CHANNEL_CREATE"},
+		{Header: "Event-Name", Value: "CHANNEL_DESTROY"},
+		{Header: "Unique-ID", Value: "46ca9b34-2bd2-464f-ad0c-082914d264a8"},
+	}
+	type args struct {
+		header string
+		value  string
+	}
+	tests := []struct {
+		name string
+		args args
+		want []Filter
+	}{
+		{
+			name: "header and value",
+			args: args{header: "Event-Name", value: "CHANNEL_CREATE"},
+			want: []Filter{filters[1], filters[2]},
+		},
+		{
+			name: "header",
+			args: args{header: "Event-Name"},
+			want: []Filter{filters[2]},
+		},
+		{
+			name: "all",
+			want: []Filter{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Connection{}
+			for _, f := range filters {
+				c.addFilter(f)
+			}
+			c.addFilter(filters[0])
+			c.deleteFilter(tt.args.header, tt.args.value)
+			if got := c.Filters(); !reflect.DeepEqual(got, tt.want) && !(len(got) == 0 && len(tt.want) == 0) {
+				t.Errorf("Filters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -39,3 +39,41 @@ func (h *Header) reset() {
 	h.contentLength = -1
 	h.args.reset()
 }
+
+// addUnescaped add the header with the value url decoded, the values of
+// text/event-plain are url encoded by FreeSWITCH, e.g. "2020-12-20%2012%3A58%3A17"
+func (h *Header) addUnescaped(key, value []byte) {
+	var kv *arg
+	h.args.kvs, kv = allocArg(h.args.kvs)
+	kv.key = append(kv.key[:0], key...)
+	kv.value = unescape(kv.value[:0], value)
+}
+
+// unescape append the url decoded src to dst, a malformed escape is kept as is
+func unescape(dst, src []byte) []byte {
+	for i := 0; i < len(src); i++ {
+		if src[i] == '%' && i+2 < len(src) {
+			hi, ok1 := unhex(src[i+1])
+			lo, ok2 := unhex(src[i+2])
+			if ok1 && ok2 {
+				dst = append(dst, hi<<4|lo)
+				i += 2
+				continue
+			}
+		}
+		dst = append(dst, src[i])
+	}
+	return dst
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
@@ -1,19 +1,41 @@
 package esl
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
 	ErrAclDenied  = errors.New("access denied, please check acl config")
 	ErrMaxRetried = errors.New("a series of reconnecting have failed")
+	// ErrAuthInvalid the user, domain or password is rejected by userauth
+	ErrAuthInvalid = errors.New("invalid userauth credentials")
 )
 
+// AuthError the -ERR reply of userauth
+type AuthError struct {
+	User  string
+	Reply string
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("userauth (user: %s) failed: %s", e.User, e.Reply)
+}
+
+// Unwrap return ErrAuthInvalid if the credentials are rejected
+func (e *AuthError) Unwrap() error {
+	if strings.HasPrefix(e.Reply, replyERR+" invalid") {
+		return ErrAuthInvalid
+	}
+	return nil
+}
+
 type Handler func(msg *Message)
 
 type Inbound struct {
@@ -24,54 +46,141 @@ type Inbound struct {
 	// Password freeswitch esl auth password
 	// Required
 	Password string
+	// User the mod_event_socket user, userauth is used instead of auth if set
+	// the user is configured with esl-password, esl-allowed-events and
+	// esl-allowed-api in the directory
+	User string
+	// Domain the domain of User
+	Domain string
 	// Maximum duration for event socket connected
 	DialTimeout time.Duration
+	// KeepAlive TCP keep-alive period
+	// Default: 0, keep-alive is enabled with the Go default period
+	// a negative value disables keep-alive
+	KeepAlive time.Duration
+	// IdleTimeout reconnect if nothing is received within the duration, e.g.
+	// the connection is half-open after a firewall drop or a VM pause
+	// "api status" is sent when nothing is received for half of it
+	// Default: 0, disabled
+	IdleTimeout time.Duration
 	// MaxReconnect max reconnect count
 	// If the value is set to 0, then no limit will be enforced
 	// Default: 0
 	MaxReconnect int
+	// ReconnectPolicy the delay between reconnect attempts
+	// Default: DefaultReconnectPolicy
+	ReconnectPolicy ReconnectPolicy
+	// QueueWhileReconnecting block the commands issued while reconnecting
+	// until reconnected, otherwise they fail with ErrDisconnected at once
+	// Default: false
+	QueueWhileReconnecting bool
 	// Apps event handlers
 	// See Applications for more information
 	Apps Applications
 
 	// internal
 	*Connection
-	closed bool
-	mu     sync.Mutex
+	// onDisconnect called when the socket is lost, before reconnecting
+	onDisconnect func()
+	closed       bool
+	quit         chan struct{}
+	mu           sync.Mutex
 }
 
 func (i *Inbound) Run() error {
-	if err := i.dial(i.Password); err != nil {
+	if err := i.dial(i.Password, i.DialTimeout); err != nil {
 		return err
 	}
+	i.Connection.setConnected()
 	go i.run()
+	if i.IdleTimeout > 0 {
+		go i.watchdog()
+	}
 	return nil
 }
 
+// watchdog send "api status" when the connection is idle for half of
+// IdleTimeout, the read deadline in waitMessage breaks the dead connection
+// it ticks at a quarter of IdleTimeout, so the probe is sent at most 3/4 of
+// IdleTimeout after the last read and the reply has time to arrive
+func (i *Inbound) watchdog() {
+	idle := i.IdleTimeout / 2
+	t := time.NewTicker(i.IdleTimeout / 4)
+	defer t.Stop()
+	quit := i.quitChan()
+	for {
+		select {
+		case <-t.C:
+		case <-quit:
+			return
+		case <-i.Connection.Done():
+			// run gave up reconnecting
+			return
+		}
+		last := atomic.LoadInt64(&i.Connection.lastRead)
+		if time.Since(time.Unix(0, last)) < idle {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), idle)
+		cmd := AcquireCommand(ApiType).SetApp("status")
+		reply := i.Connection.roundTrip(ctx, cmd)
+		releaseCommand(cmd)
+		cancel()
+		if reply.Message != nil {
+			ReleaseMessage(reply.Message)
+		}
+	}
+}
+
 func (i *Inbound) run() {
 	for {
 		i.Connection.waitMessage()
-		_ = i.Connection.Close()
+		_ = i.conn.Close()
+		if i.onDisconnect != nil {
+			i.onDisconnect()
+		}
 
-		if i.closed {
+		if i.isClosed() {
 			break
 		}
 
 		if err := i.reconnect(); err != nil {
-			logger.Printf("esl reconnected failed: %v", err)
+			if !i.isClosed() {
+				logger.Printf("esl reconnected failed: %v", err)
+			}
+			i.Connection.shutdown()
 			break
 		}
 	}
 }
 
-func (i *Inbound) dial(password string) error {
-	conn, err := net.DialTimeout("tcp", i.Address, i.DialTimeout)
+func (i *Inbound) isClosed() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.closed
+}
+
+// quitChan return the channel closed by Close
+func (i *Inbound) quitChan() chan struct{} {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.quit == nil {
+		i.quit = make(chan struct{})
+	}
+	return i.quit
+}
+
+func (i *Inbound) dial(password string, timeout time.Duration) error {
+	d := net.Dialer{Timeout: timeout, KeepAlive: i.KeepAlive}
+	conn, err := d.Dial("tcp", i.Address)
 	if err != nil {
 		return err
 	}
 	if i.Connection == nil {
 		i.Connection = acquireConnection(conn, inbound)
 		i.Connection.apps = &i.Apps
+		i.Connection.queueing = i.QueueWhileReconnecting
+		i.Connection.idleTimeout = i.IdleTimeout
 	} else {
 		i.Connection.reset(conn)
 	}
@@ -81,11 +190,17 @@ func (i *Inbound) dial(password string) error {
 		_ = conn.Close()
 		return err
 	}
-	if t := msg.ContentType(); t != authRequest {
+	t := msg.ContentType()
+	ReleaseMessage(msg)
+	switch t {
+	case authRequest:
+	case rudeRejection:
+		_ = conn.Close()
+		return ErrAclDenied
+	default:
 		_ = conn.Close()
 		return fmt.Errorf("invalid auth request: %s", t)
 	}
-	ReleaseMessage(msg)
 	if err = i.authenticate(password); err != nil {
 		_ = conn.Close()
 		return err
@@ -97,6 +212,9 @@ func (i *Inbound) dial(password string) error {
 
 // authenticate auth for inbound mode
 func (i *Inbound) authenticate(password string) error {
+	if i.User != "" {
+		return i.userauth(password)
+	}
 	_, err := fmt.Fprintf(i.conn, "auth %s\n\n", password)
 	if err != nil {
 		return fmt.Errorf("unable to send auth request: %v", err)
@@ -114,21 +232,100 @@ func (i *Inbound) authenticate(password string) error {
 	return nil
 }
 
+// userauth auth as a mod_event_socket user
+func (i *Inbound) userauth(password string) error {
+	user := i.User
+	if i.Domain != "" {
+		user += "@" + i.Domain
+	}
+	_, err := fmt.Fprintf(i.conn, "userauth %s:%s\n\n", user, password)
+	if err != nil {
+		return fmt.Errorf("unable to send userauth request: %v", err)
+	}
+
+	msg, err := parseMessage(i.Connection.r)
+	if err != nil {
+		return err
+	}
+	reply := msg.Header.Get("Reply-Text")
+	ReleaseMessage(msg)
+	if !strings.HasPrefix(reply, replyOK) {
+		return &AuthError{User: user, Reply: reply}
+	}
+	return nil
+}
+
 func (i *Inbound) reconnect() error {
-	for count := 1; i.MaxReconnect == 0 || count <= i.MaxReconnect; count++ {
-		err := i.dial(i.Password)
+	policy := i.ReconnectPolicy
+	if policy == nil {
+		policy = DefaultReconnectPolicy
+	}
+	quit := i.quitChan()
+	for attempt := 1; ; attempt++ {
+		timeout := policy.DialTimeout(attempt)
+		if timeout == 0 {
+			timeout = i.DialTimeout
+		}
+		err := i.dial(i.Password, timeout)
+		status := ReconnectStatus{Attempt: attempt, Err: err}
+		if err == nil {
+			if i.isClosed() {
+				// closed while dialing, Close may have missed the new socket
+				_ = i.conn.Close()
+				return ErrDisconnected
+			}
+			// the reader must be running for the replies of the restoring
+			// commands, OnReconnect is called after restored
+			go i.restore(i.Connection.setOnline(), status)
+			return nil
+		}
+		// rejected by acl, retrying doesn't help
+		last := err == ErrAclDenied || (i.MaxReconnect > 0 && attempt >= i.MaxReconnect)
+		if !last {
+			status.Delay = policy.Delay(attempt)
+		}
 		if i.apps.OnReconnect != nil {
-			i.apps.OnReconnect(i, err)
+			i.apps.OnReconnect(i, status)
 		}
-		if err != nil {
-			continue
+		switch {
+		case err == ErrAclDenied:
+			return err
+		case last:
+			return ErrMaxRetried
+		}
+
+		t := time.NewTimer(status.Delay)
+		select {
+		case <-t.C:
+		case <-quit:
+			t.Stop()
+			return ErrDisconnected
 		}
-		return nil
 	}
-	return ErrMaxRetried
+}
+
+// restore replay the session, then release the commands of the callers
+func (i *Inbound) restore(gen uint64, status ReconnectStatus) {
+	status.RestoreErr = i.Connection.restore(context.Background())
+	if status.RestoreErr == ErrDisconnected || !i.Connection.promote(gen) {
+		// lost again, the next reconnect restores the session
+		return
+	}
+	if status.RestoreErr != nil {
+		logger.Printf("unable to restore the esl session: %v", status.RestoreErr)
+	}
+	if i.apps.OnReconnect != nil {
+		i.apps.OnReconnect(i, status)
+	}
 }
 
 func (i *Inbound) Close() error {
-	i.closed = true
+	quit := i.quitChan()
+	i.mu.Lock()
+	if !i.closed {
+		i.closed = true
+		close(quit)
+	}
+	i.mu.Unlock()
 	return i.Connection.Close()
 }
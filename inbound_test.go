@@ -3,8 +3,14 @@ package esl
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 func messageEqual(m1, m2 Message) bool {
@@ -107,3 +113,432 @@ func TestClient_waitMessage(t *testing.T) {
 		})
 	}
 }
+
+func TestInbound_userauth(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string
+		wantReq string
+		wantErr error
+	}{
+		{
+			name:    "accepted",
+			reply:   "Content-Type: command/reply\nReply-Text: +OK accepted\n\n",
+			wantReq: "userauth monitor@default:secret\n\n",
+		},
+		{
+			name:    "invalid",
+			reply:   "Content-Type: command/reply\nReply-Text: -ERR invalid\n\n",
+			wantReq: "userauth monitor@default:secret\n\n",
+			wantErr: ErrAuthInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+			go func() {
+				buf := make([]byte, len(tt.wantReq))
+				if _, err := io.ReadFull(server, buf); err != nil || string(buf) != tt.wantReq {
+					t.Errorf("request = %q, want %q", buf, tt.wantReq)
+				}
+				_, _ = server.Write([]byte(tt.reply))
+			}()
+
+			i := &Inbound{User: "monitor", Domain: "default", Connection: acquireConnection(client, inbound)}
+			err := i.authenticate("secret")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInbound_dialRudeRejection(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		_, _ = conn.Write([]byte("Content-Type: text/rude-rejection\nContent-Length: 24\n\nAccess Denied, go away.\n"))
+		_ = conn.Close()
+	}()
+
+	i := &Inbound{Address: l.Addr().String(), Password: "ClueCon"}
+	if err := i.dial(i.Password, time.Second); err != ErrAclDenied {
+		t.Errorf("dial() error = %v, want %v", err, ErrAclDenied)
+	}
+}
+
+// serveAuth accept the auth and reply each command with +OK
+// the commands are passed to cmds, the socket is closed when hangup is closed
+func serveAuth(conn net.Conn, cmds chan<- string, hangup <-chan struct{}) {
+	defer conn.Close()
+	go func() {
+		<-hangup
+		_ = conn.Close()
+	}()
+	r := bufio.NewReader(conn)
+	_, _ = conn.Write([]byte("Content-Type: auth/request\n\n"))
+	if _, err := readCommand(r); err != nil {
+		return
+	}
+	_, _ = conn.Write([]byte("Content-Type: command/reply\nReply-Text: +OK accepted\n\n"))
+	for {
+		cmd, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		cmds <- strings.TrimSpace(cmd)
+		_, _ = conn.Write([]byte("Content-Type: command/reply\nReply-Text: +OK\n\n"))
+	}
+}
+
+func TestInbound_restore(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	cmds := make(chan string, 16)
+	hangup := make(chan struct{})
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go serveAuth(conn, cmds, hangup)
+		conn, err = l.Accept()
+		if err != nil {
+			return
+		}
+		serveAuth(conn, cmds, make(chan struct{}))
+	}()
+
+	restored := make(chan ReconnectStatus, 1)
+	i := &Inbound{
+		Address:         l.Addr().String(),
+		Password:        "ClueCon",
+		ReconnectPolicy: &BackoffPolicy{Initial: time.Millisecond},
+		Apps: Applications{OnReconnect: func(c *Inbound, status ReconnectStatus) {
+			if status.Err == nil {
+				restored <- status
+			}
+		}},
+	}
+	if err := i.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	defer i.Close()
+
+	replies := []CommandReply{
+		i.Event(EventPlain, "HEARTBEAT CUSTOM sofia::register"),
+		i.Filter("Event-Name", "HEARTBEAT"),
+		i.Log(7),
+	}
+	for _, reply := range replies {
+		if err := reply.Err(); err != nil {
+			t.Fatalf("Err() = %v", err)
+		}
+	}
+	for n := 0; n < 3; n++ {
+		<-cmds
+	}
+	close(hangup)
+
+	select {
+	case status := <-restored:
+		if status.RestoreErr != nil {
+			t.Errorf("RestoreErr = %v", status.RestoreErr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("not reconnected")
+	}
+	want := []string{"filter Event-Name HEARTBEAT", "log 7", "event plain HEARTBEAT CUSTOM sofia::register"}
+	for _, w := range want {
+		if got := <-cmds; got != w {
+			t.Errorf("restored command = %q, want %q", got, w)
+		}
+	}
+	if !i.Connected() {
+		t.Errorf("Connected() = false, want true")
+	}
+}
+
+func TestInbound_watchdog(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		// the first socket is half-open: authenticated, but never replies
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		_, _ = conn.Write([]byte("Content-Type: auth/request\n\n"))
+		if _, err := readCommand(r); err != nil {
+			return
+		}
+		_, _ = conn.Write([]byte("Content-Type: command/reply\nReply-Text: +OK accepted\n\n"))
+
+		conn, err = l.Accept()
+		if err != nil {
+			return
+		}
+		serveAuth(conn, make(chan string, 16), make(chan struct{}))
+	}()
+
+	reconnected := make(chan struct{}, 1)
+	i := &Inbound{
+		Address:         l.Addr().String(),
+		Password:        "ClueCon",
+		IdleTimeout:     100 * time.Millisecond,
+		ReconnectPolicy: &BackoffPolicy{Initial: time.Millisecond},
+		Apps: Applications{OnReconnect: func(c *Inbound, status ReconnectStatus) {
+			if status.Err == nil {
+				reconnected <- struct{}{}
+			}
+		}},
+	}
+	if err := i.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	defer i.Close()
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the dead connection is not detected")
+	}
+}
+
+func TestInbound_watchdogQuiet(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		// alive but quiet: no events, every command is answered in 15ms
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		_, _ = conn.Write([]byte("Content-Type: auth/request\n\n"))
+		for {
+			if _, err := readCommand(r); err != nil {
+				return
+			}
+			time.Sleep(15 * time.Millisecond)
+			_, _ = conn.Write([]byte("Content-Type: command/reply\nReply-Text: +OK\n\n"))
+		}
+	}()
+
+	reconnects := make(chan ReconnectStatus, 16)
+	i := &Inbound{
+		Address:         l.Addr().String(),
+		Password:        "ClueCon",
+		IdleTimeout:     100 * time.Millisecond,
+		ReconnectPolicy: &BackoffPolicy{Initial: time.Millisecond},
+		Apps: Applications{OnReconnect: func(c *Inbound, status ReconnectStatus) {
+			reconnects <- status
+		}},
+	}
+	if err := i.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	defer i.Close()
+
+	time.Sleep(time.Second)
+	if n := len(reconnects); n != 0 {
+		t.Errorf("reconnected %d times, want 0", n)
+	}
+	if !i.Connected() {
+		t.Errorf("Connected() = false, want true")
+	}
+}
+
+// closingPolicy close the Inbound right before the reconnect dial
+type closingPolicy struct {
+	i *Inbound
+}
+
+func (p closingPolicy) Delay(attempt int) time.Duration { return time.Millisecond }
+
+func (p closingPolicy) DialTimeout(attempt int) time.Duration {
+	_ = p.i.Close()
+	return 0
+}
+
+func TestInbound_closeWhileReconnecting(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	hangup := make(chan struct{})
+	released := make(chan struct{})
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go serveAuth(conn, make(chan string, 16), hangup)
+
+		// the reconnect socket must be closed by the client
+		conn, err = l.Accept()
+		if err != nil {
+			return
+		}
+		serveAuth(conn, make(chan string, 16), make(chan struct{}))
+		close(released)
+	}()
+
+	i := &Inbound{
+		Address:  l.Addr().String(),
+		Password: "ClueCon",
+	}
+	i.ReconnectPolicy = closingPolicy{i: i}
+	if err := i.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	close(hangup)
+
+	select {
+	case <-released:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the socket dialed after Close is not closed")
+	}
+}
+
+func TestInbound_restoreExcluded(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	cmds := make(chan string, 16)
+	hangup := make(chan struct{})
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go serveAuth(conn, cmds, hangup)
+		conn, err = l.Accept()
+		if err != nil {
+			return
+		}
+		serveAuth(conn, cmds, make(chan struct{}))
+	}()
+
+	restored := make(chan struct{}, 1)
+	i := &Inbound{
+		Address:         l.Addr().String(),
+		Password:        "ClueCon",
+		ReconnectPolicy: &BackoffPolicy{Initial: time.Millisecond},
+		Apps: Applications{OnReconnect: func(c *Inbound, status ReconnectStatus) {
+			if status.Err == nil {
+				restored <- struct{}{}
+			}
+		}},
+	}
+	if err := i.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	defer i.Close()
+
+	replies := []CommandReply{
+		i.Event(EventPlain, "ALL"),
+		i.NixEvent("PRESENCE_IN", "CHANNEL_CALLSTATE"),
+	}
+	for _, reply := range replies {
+		if err := reply.Err(); err != nil {
+			t.Fatalf("Err() = %v", err)
+		}
+	}
+	if got := i.Subscription().Excluded; len(got) != 2 {
+		t.Errorf("Subscription().Excluded = %v, want 2 names", got)
+	}
+	<-cmds
+	<-cmds
+	close(hangup)
+
+	select {
+	case <-restored:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not reconnected")
+	}
+	want := []string{"event plain ALL", "nixevent PRESENCE_IN CHANNEL_CALLSTATE"}
+	for _, w := range want {
+		if got := <-cmds; got != w {
+			t.Errorf("restored command = %q, want %q", got, w)
+		}
+	}
+}
+
+func TestInbound_watchdogGaveUp(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hangup := make(chan struct{})
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		serveAuth(conn, make(chan string, 16), hangup)
+	}()
+
+	gaveUp := make(chan struct{})
+	i := &Inbound{
+		Address:         l.Addr().String(),
+		Password:        "ClueCon",
+		IdleTimeout:     40 * time.Millisecond,
+		MaxReconnect:    1,
+		ReconnectPolicy: &BackoffPolicy{Initial: time.Millisecond},
+		Apps: Applications{OnReconnect: func(c *Inbound, status ReconnectStatus) {
+			if status.Err != nil {
+				close(gaveUp)
+			}
+		}},
+	}
+	if err := i.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	// the node is gone for good, the reconnect fails
+	_ = l.Close()
+	close(hangup)
+	<-gaveUp
+
+	deadline := time.Now().Add(5 * time.Second)
+	buf := make([]byte, 1<<20)
+	for {
+		stacks := string(buf[:runtime.Stack(buf, true)])
+		if !strings.Contains(stacks, "(*Inbound).watchdog") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the watchdog is still running after run gave up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,148 @@
+package esl
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrJobTimeout the background job is not completed in time
+var ErrJobTimeout = errors.New("esl: background job timeout")
+
+// BgapiJob a background job started by Connection.BgapiJob
+type BgapiJob struct {
+	id   string
+	c    *Connection
+	once sync.Once
+	done chan struct{}
+	body string
+	err  error
+}
+
+// ID return the Job-UUID
+func (j *BgapiJob) ID() string {
+	return j.id
+}
+
+// Done closed when the job is completed or failed
+func (j *BgapiJob) Done() <-chan struct{} {
+	return j.done
+}
+
+// Result return the job result, only valid after Done is closed
+func (j *BgapiJob) Result() (string, error) {
+	return j.body, j.err
+}
+
+// Wait wait for the job result, e.g. "+OK 46ca9b34-2bd2-464f-ad0c-082914d264a8\n"
+// if timeout > 0 and the job is not completed in time, the job is dropped and
+// ErrJobTimeout is returned
+func (j *BgapiJob) Wait(timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		<-j.done
+		return j.Result()
+	}
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-j.done:
+	case <-t.C:
+		j.c.removeJob(j.id)
+		j.complete("", ErrJobTimeout)
+	}
+	return j.Result()
+}
+
+// WaitContext is like Wait but the job is dropped and ctx.Err() is returned
+// when ctx is done
+func (j *BgapiJob) WaitContext(ctx context.Context) (string, error) {
+	select {
+	case <-j.done:
+	case <-ctx.Done():
+		j.c.removeJob(j.id)
+		j.complete("", ctx.Err())
+	}
+	return j.Result()
+}
+
+func (j *BgapiJob) complete(body string, err error) {
+	j.once.Do(func() {
+		j.body = body
+		j.err = err
+		close(j.done)
+	})
+}
+
+func (c *Connection) addJob(id string) *BgapiJob {
+	job := &BgapiJob{id: id, c: c, done: make(chan struct{})}
+	c.jmu.Lock()
+	if c.jobs == nil {
+		c.jobs = make(map[string]*BgapiJob)
+	}
+	c.jobs[id] = job
+	c.jmu.Unlock()
+	return job
+}
+
+func (c *Connection) removeJob(id string) {
+	c.jmu.Lock()
+	delete(c.jobs, id)
+	c.jmu.Unlock()
+}
+
+// resolveJob complete the job of the BACKGROUND_JOB event
+func (c *Connection) resolveJob(msg *Message) {
+	id := msg.Header.Get("Job-UUID")
+	c.jmu.Lock()
+	job, ok := c.jobs[id]
+	delete(c.jobs, id)
+	c.jmu.Unlock()
+	if ok {
+		job.complete(string(msg.Body()), nil)
+	}
+}
+
+func (c *Connection) addExec(id string) chan *Message {
+	ch := make(chan *Message, 1)
+	c.jmu.Lock()
+	if c.execs == nil {
+		c.execs = make(map[string]chan *Message)
+	}
+	c.execs[id] = ch
+	c.jmu.Unlock()
+	return ch
+}
+
+func (c *Connection) removeExec(id string) {
+	c.jmu.Lock()
+	delete(c.execs, id)
+	c.jmu.Unlock()
+}
+
+// resolveExec pass a copy of the CHANNEL_EXECUTE_COMPLETE event to ExecuteAndWait
+func (c *Connection) resolveExec(msg *Message) {
+	id := msg.Header.Get("Application-UUID")
+	c.jmu.Lock()
+	ch, ok := c.execs[id]
+	delete(c.execs, id)
+	c.jmu.Unlock()
+	if ok {
+		ch <- msg.clone()
+	}
+}
+
+// failJobs fail all pending jobs and executions, the events are never received
+func (c *Connection) failJobs(err error) {
+	c.jmu.Lock()
+	jobs, execs := c.jobs, c.execs
+	c.jobs, c.execs = nil, nil
+	c.jmu.Unlock()
+	for _, job := range jobs {
+		job.complete("", err)
+	}
+	for _, ch := range execs {
+		close(ch)
+	}
+}
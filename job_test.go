@@ -0,0 +1,85 @@
+package esl
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnection_BgapiJob(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	jobID := "7f4de4bc-17d7-11dd-b7a0-db4edd065621"
+	go func() {
+		r := bufio.NewReader(server)
+		req, err := parseMessage(r)
+		if err != nil {
+			return
+		}
+		if got := req.Header.Get("Job-UUID"); got != jobID {
+			t.Errorf("Job-UUID = %v, want %v", got, jobID)
+		}
+		_, _ = fmt.Fprintf(server, "Content-Type: command/reply\nReply-Text: +OK Job-UUID: %s\nJob-UUID: %s\n\n", jobID, jobID)
+		body := "+OK 46ca9b34-2bd2-464f-ad0c-082914d264a8\n"
+		event := fmt.Sprintf("Event-Name: BACKGROUND_JOB\nJob-UUID: %s\nJob-Command: originate\nContent-Length: %d\n\n%s", jobID, len(body), body)
+		_, _ = fmt.Fprintf(server, "Content-Length: %d\nContent-Type: text/event-plain\n\n%s", len(event), event)
+	}()
+
+	c := acquireConnection(client, inbound)
+	c.apps = &Applications{}
+	c.setConnected()
+	go c.waitMessage()
+
+	job, err := c.BgapiJob("originate", "user/1000 &park", jobID)
+	if err != nil {
+		t.Fatalf("BgapiJob() error = %v", err)
+	}
+	body, err := job.Wait(time.Second)
+	if err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if want := "+OK 46ca9b34-2bd2-464f-ad0c-082914d264a8\n"; body != want {
+		t.Errorf("Wait() = %q, want %q", body, want)
+	}
+}
+
+func TestConnection_ExecuteAndWait(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		r := bufio.NewReader(server)
+		req, err := parseMessage(r)
+		if err != nil {
+			return
+		}
+		id := req.Header.Get("Event-UUID")
+		if got := req.Header.Get("event-lock"); got != "true" {
+			t.Errorf("event-lock = %v, want %v", got, "true")
+		}
+		_, _ = fmt.Fprint(server, "Content-Type: command/reply\nReply-Text: +OK\n\n")
+		event := fmt.Sprintf("Event-Name: CHANNEL_EXECUTE_COMPLETE\nApplication: read\nApplication-Response: 1234\nApplication-UUID: %s\n\n", id)
+		_, _ = fmt.Fprintf(server, "Content-Length: %d\nContent-Type: text/event-plain\n\n%s", len(event), event)
+	}()
+
+	c := acquireConnection(client, outbound)
+	c.apps = &Applications{}
+	c.setConnected()
+	go c.waitMessage()
+
+	resp, event, err := c.ExecuteAndWait("read", "1 4 foo.wav digits 5000 #")
+	if err != nil {
+		t.Fatalf("ExecuteAndWait() error = %v", err)
+	}
+	if resp != "1234" {
+		t.Errorf("ExecuteAndWait() response = %v, want %v", resp, "1234")
+	}
+	if got := event.Header.Get("Application"); got != "read" {
+		t.Errorf("Application = %v, want %v", got, "read")
+	}
+}
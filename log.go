@@ -0,0 +1,31 @@
+package esl
+
+import "strconv"
+
+// LogRecord a FreeSWITCH log line received after Connection.Log
+type LogRecord struct {
+	// Level log level, 0 (CONSOLE) - 7 (DEBUG)
+	Level int
+	// Channel text channel
+	Channel int
+	File    string
+	Func    string
+	Line    int
+	// UUID the Unique-ID of the channel which produced the log, from User-Data
+	UUID string
+	// Text the log line
+	Text string
+}
+
+func parseLogRecord(msg *Message) *LogRecord {
+	rec := &LogRecord{
+		File: msg.Header.Get("Log-File"),
+		Func: msg.Header.Get("Log-Func"),
+		UUID: msg.Header.Get("User-Data"),
+		Text: string(msg.Body()),
+	}
+	rec.Level, _ = strconv.Atoi(msg.Header.Get("Log-Level"))
+	rec.Channel, _ = strconv.Atoi(msg.Header.Get("Text-Channel"))
+	rec.Line, _ = strconv.Atoi(msg.Header.Get("Log-Line"))
+	return rec
+}
@@ -0,0 +1,54 @@
+package esl
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func Test_parseLogRecord(t *testing.T) {
+	r := bufio.NewReader(bytes.NewReader([]byte("Content-Type: log/data\nContent-Length: 57\nLog-Level: 7\nText-Channel: 3\nLog-File: mod_commands.c\nLog-Func: uuid_kill_function\nLog-Line: 6391\nUser-Data: 46ca9b34-2bd2-464f-ad0c-082914d264a8\n\n2020-11-08 09:57:16.712466 [DEBUG] mod_commands.c:6391 2\n")))
+	msg, err := parseMessage(r)
+	if err != nil {
+		t.Fatalf("parseMessage() error = %v", err)
+	}
+	want := &LogRecord{
+		Level:   7,
+		Channel: 3,
+		File:    "mod_commands.c",
+		Func:    "uuid_kill_function",
+		Line:    6391,
+		UUID:    "46ca9b34-2bd2-464f-ad0c-082914d264a8",
+		Text:    "2020-11-08 09:57:16.712466 [DEBUG] mod_commands.c:6391 2\n",
+	}
+	if got := parseLogRecord(msg); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseLogRecord() = %v, want %v", got, want)
+	}
+}
+
+func TestConnection_logOrder(t *testing.T) {
+	var buf bytes.Buffer
+	for i := 0; i < 500; i++ {
+		text := fmt.Sprintf("line %d\n", i)
+		fmt.Fprintf(&buf, "Content-Type: log/data\nContent-Length: %d\nLog-Level: 7\n\n%s", len(text), text)
+	}
+	var got []string
+	c := &Connection{
+		apps: &Applications{OnLog: func(rec *LogRecord) {
+			got = append(got, rec.Text)
+		}},
+		r: bufio.NewReader(&buf),
+	}
+	c.waitMessage()
+
+	if len(got) != 500 {
+		t.Fatalf("received %d records, want 500", len(got))
+	}
+	for i, text := range got {
+		if want := fmt.Sprintf("line %d\n", i); text != want {
+			t.Fatalf("record %d = %q, want %q", i, text, want)
+		}
+	}
+}
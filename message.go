@@ -3,6 +3,8 @@ package esl
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"strings"
@@ -15,7 +17,9 @@ type Message struct {
 	Header Header
 
 	// bs body start
-	bs   int
+	bs int
+	// be body end, 0 means Content-Length
+	be   int
 	body []byte
 }
 
@@ -59,10 +63,11 @@ func (m *Message) parse(r *bufio.Reader) error {
 			}
 			// has body
 			if n > 0 {
-				if len(m.body) < n {
+				if cap(m.body) < n {
 					m.body = make([]byte, n)
 				}
-				_, err = io.ReadFull(r, m.body[:n])
+				m.body = m.body[:n]
+				_, err = io.ReadFull(r, m.body)
 				if err != nil {
 					return err
 				}
@@ -75,6 +80,9 @@ func (m *Message) parse(r *bufio.Reader) error {
 
 // Body return message body
 func (m *Message) Body() []byte {
+	if m.be > 0 {
+		return m.body[m.bs:m.be]
+	}
 	n, _ := m.Header.ContentLength()
 	return m.body[m.bs:n]
 }
@@ -85,10 +93,43 @@ func (m *Message) Bytes() []byte {
 	return m.body[:n]
 }
 
+// clone return a deep copy of the message
+func (m *Message) clone() *Message {
+	dst := NewMessage()
+	for i, n := 0, len(m.Header.args.kvs); i < n; i++ {
+		kv := &m.Header.args.kvs[i]
+		dst.Header.AddBytes(kv.key, kv.value)
+	}
+	end, _ := m.Header.ContentLength()
+	if m.be > end {
+		end = m.be
+	}
+	dst.Header.contentLength = m.Header.contentLength
+	dst.bs = m.bs
+	dst.be = m.be
+	dst.body = append([]byte(nil), m.body[:end]...)
+	return dst
+}
+
 func (m *Message) ContentType() string {
 	return m.Header.Get("Content-Type")
 }
 
+// event parse the event payload according to the content type
+func (m *Message) event() (*Message, error) {
+	switch ct := m.ContentType(); ct {
+	case eventPlain:
+		return m.payload(), nil
+	case eventJSON:
+		return m.payloadJSON()
+	case eventXML:
+		return m.payloadXML()
+	default:
+		return nil, fmt.Errorf("unknown event content type: %s", ct)
+	}
+}
+
+// payload parse the text/event-plain payload, the header values are url decoded
 func (m *Message) payload() *Message {
 	buf := m.Body()
 	m.Header.args.reset()
@@ -100,7 +141,8 @@ func (m *Message) payload() *Message {
 		}
 		i := bytes.IndexByte(buf, ':')
 		if i != -1 {
-			m.Header.AddBytes(buf[:i], buf[i+2:l])
+			// decoded to match the values of json and xml events
+			m.Header.addUnescaped(buf[:i], buf[i+2:l])
 		}
 
 		if len(buf) >= l+1 {
@@ -117,8 +159,136 @@ func (m *Message) payload() *Message {
 	return m
 }
 
+// payloadJSON parse the text/event-json payload
+// headers keep the order on the wire, _body is mapped to Body()
+// array values are joined as FreeSWITCH does in plain events: ARRAY::v1|:v2
+func (m *Message) payloadJSON() (*Message, error) {
+	raw := m.Bytes()
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := dec.Token(); err != nil {
+		return nil, err
+	} else if tok != json.Delim('{') {
+		return nil, fmt.Errorf("unexpected json token: %v", tok)
+	}
+
+	m.Header.args.reset()
+	var body []byte
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected json token: %v", tok)
+		}
+		var v json.RawMessage
+		if err = dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		value, err := jsonValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %v", key, err)
+		}
+		if key == "_body" {
+			body = value
+			continue
+		}
+		m.Header.AddBytes([]byte(key), value)
+	}
+
+	n := len(raw)
+	m.body = append(m.body[:n], body...)
+	m.bs = n
+	m.be = n + len(body)
+	return m, nil
+}
+
+var strArrayPrefix = []byte("ARRAY::")
+
+func jsonValue(v json.RawMessage) ([]byte, error) {
+	switch {
+	case len(v) > 0 && v[0] == '"':
+		var s string
+		err := json.Unmarshal(v, &s)
+		return []byte(s), err
+	case len(v) > 0 && v[0] == '[':
+		var vs []string
+		if err := json.Unmarshal(v, &vs); err != nil {
+			return nil, err
+		}
+		dst := append([]byte(nil), strArrayPrefix...)
+		for i, s := range vs {
+			if i > 0 {
+				dst = append(dst, '|', ':')
+			}
+			dst = append(dst, s...)
+		}
+		return dst, nil
+	default:
+		return v, nil
+	}
+}
+
+// payloadXML parse the text/event-xml payload
+// <event><headers><Event-Name>...</Event-Name></headers><body>...</body></event>
+func (m *Message) payloadXML() (*Message, error) {
+	raw := m.Bytes()
+	dec := xml.NewDecoder(bytes.NewReader(raw))
+
+	m.Header.args.reset()
+	var (
+		depth   int
+		section string
+		text    []byte
+		body    []byte
+	)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			text = text[:0]
+			switch depth {
+			case 1:
+				if t.Name.Local != "event" {
+					return nil, fmt.Errorf("unexpected xml element: %s", t.Name.Local)
+				}
+			case 2:
+				section = t.Name.Local
+			}
+		case xml.CharData:
+			text = append(text, t...)
+		case xml.EndElement:
+			switch {
+			case depth == 3 && section == "headers":
+				m.Header.AddBytes([]byte(t.Name.Local), text)
+			case depth == 2 && section == "body":
+				body = append(body[:0], text...)
+			}
+			depth--
+			text = text[:0]
+		}
+	}
+
+	n := len(raw)
+	m.body = append(m.body[:n], body...)
+	m.bs = n
+	m.be = n + len(body)
+	return m, nil
+}
+
 func (m *Message) reset() {
 	m.bs = 0
+	m.be = 0
+	// the buffer is kept, the bytes of the previous message are not
+	m.body = m.body[:0]
 	m.Header.reset()
 }
 
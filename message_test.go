@@ -27,9 +27,9 @@ func TestMessage_payload(t *testing.T) {
 				{key: []byte("FreeSWITCH-Hostname"), value: []byte("localhost.localdomain")},
 				{key: []byte("FreeSWITCH-Switchname"), value: []byte("localhost.localdomain")},
 				{key: []byte("FreeSWITCH-IPv4"), value: []byte("192.168.40.192")},
-				{key: []byte("FreeSWITCH-IPv6"), value: []byte("%3A%3A1")},
-				{key: []byte("Event-Date-Local"), value: []byte("2020-12-20%2012%3A58%3A17")},
-				{key: []byte("Event-Date-GMT"), value: []byte("Sun,%2020%20Dec%202020%2004%3A58%3A17%20GMT")},
+				{key: []byte("FreeSWITCH-IPv6"), value: []byte("::1")},
+				{key: []byte("Event-Date-Local"), value: []byte("2020-12-20 12:58:17")},
+				{key: []byte("Event-Date-GMT"), value: []byte("Sun, 20 Dec 2020 04:58:17 GMT")},
 				{key: []byte("Event-Date-Timestamp"), value: []byte("1608440297753799")},
 				{key: []byte("Event-Calling-File"), value: []byte("switch_loadable_module.c")},
 				{key: []byte("Event-Calling-Function"), value: []byte("switch_api_execute")},
@@ -113,3 +113,106 @@ func TestCommandReply_Err(t *testing.T) {
 		})
 	}
 }
+
+func TestMessage_payloadJSON(t *testing.T) {
+	raw := []byte(`{"Event-Name":"CUSTOM","Event-Subclass":"test::json","Event-Date-Local":"2020-12-20 12:58:17","variable_array":["a","b"],"Content-Length":"9","_body":"body test"}`)
+	e := &Message{
+		Header: Header{contentLength: len(raw)},
+		body:   raw,
+	}
+	got, err := e.payloadJSON()
+	if err != nil {
+		t.Fatalf("payloadJSON() error = %v", err)
+	}
+	want := Message{Header: Header{contentLength: len(raw), args: Args{kvs: []arg{
+		{key: []byte("Event-Name"), value: []byte("CUSTOM")},
+		{key: []byte("Event-Subclass"), value: []byte("test::json")},
+		{key: []byte("Event-Date-Local"), value: []byte("2020-12-20 12:58:17")},
+		{key: []byte("variable_array"), value: []byte("ARRAY::a|:b")},
+		{key: []byte("Content-Length"), value: []byte("9")},
+	}}}, bs: len(raw), body: append(append([]byte(nil), raw...), "body test"...)}
+	if !messageEqual(*got, want) {
+		t.Errorf("payloadJSON() = %v, want %v", got, want)
+	}
+	if string(got.Body()) != "body test" {
+		t.Errorf("Body() = %s, want %s", got.Body(), "body test")
+	}
+	if string(got.Bytes()) != string(raw) {
+		t.Errorf("Bytes() = %s, want %s", got.Bytes(), raw)
+	}
+}
+
+func TestMessage_payloadXML(t *testing.T) {
+	raw := []byte("<event>\n  <headers>\n    <Event-Name>CUSTOM</Event-Name>\n    <Event-Subclass>test::xml</Event-Subclass>\n    <Caller-Caller-ID-Name>Tom &amp; Jerry</Caller-Caller-ID-Name>\n    <Content-Length>9</Content-Length>\n  </headers>\n  <body>body test</body>\n</event>")
+	e := &Message{
+		Header: Header{contentLength: len(raw)},
+		body:   raw,
+	}
+	got, err := e.payloadXML()
+	if err != nil {
+		t.Fatalf("payloadXML() error = %v", err)
+	}
+	want := Message{Header: Header{contentLength: len(raw), args: Args{kvs: []arg{
+		{key: []byte("Event-Name"), value: []byte("CUSTOM")},
+		{key: []byte("Event-Subclass"), value: []byte("test::xml")},
+		{key: []byte("Caller-Caller-ID-Name"), value: []byte("Tom & Jerry")},
+		{key: []byte("Content-Length"), value: []byte("9")},
+	}}}, bs: len(raw), body: append(append([]byte(nil), raw...), "body test"...)}
+	if !messageEqual(*got, want) {
+		t.Errorf("payloadXML() = %v, want %v", got, want)
+	}
+	if string(got.Body()) != "body test" {
+		t.Errorf("Body() = %s, want %s", got.Body(), "body test")
+	}
+}
+
+func TestMessage_eventFormats(t *testing.T) {
+	payloads := map[string]string{
+		eventPlain: "Event-Name: CUSTOM\nEvent-Date-Local: 2020-12-20%2012%3A58%3A17\nCaller-Caller-ID-Name: Tom%20%26%20Jerry\nvariable_array: ARRAY%3A%3Aa%7C%3Ab\nContent-Length: 9\n\nbody test",
+		eventJSON:  `{"Event-Name":"CUSTOM","Event-Date-Local":"2020-12-20 12:58:17","Caller-Caller-ID-Name":"Tom & Jerry","variable_array":["a","b"],"Content-Length":"9","_body":"body test"}`,
+		eventXML:   "<event><headers><Event-Name>CUSTOM</Event-Name><Event-Date-Local>2020-12-20 12:58:17</Event-Date-Local><Caller-Caller-ID-Name>Tom &amp; Jerry</Caller-Caller-ID-Name><variable_array>ARRAY::a|:b</variable_array><Content-Length>9</Content-Length></headers><body>body test</body></event>",
+	}
+	want := map[string]string{
+		"Event-Name":            "CUSTOM",
+		"Event-Date-Local":      "2020-12-20 12:58:17",
+		"Caller-Caller-ID-Name": "Tom & Jerry",
+		"variable_array":        "ARRAY::a|:b",
+	}
+	for ct, payload := range payloads {
+		t.Run(ct, func(t *testing.T) {
+			e := NewMessage()
+			e.Header.Set("Content-Type", ct)
+			e.Header.contentLength = len(payload)
+			e.body = []byte(payload)
+			got, err := e.event()
+			if err != nil {
+				t.Fatalf("event() error = %v", err)
+			}
+			for k, v := range want {
+				if got.Header.Get(k) != v {
+					t.Errorf("Header.Get(%q) = %q, want %q", k, got.Header.Get(k), v)
+				}
+			}
+			if string(got.Body()) != "body test" {
+				t.Errorf("Body() = %q, want %q", got.Body(), "body test")
+			}
+		})
+	}
+}
+
+func Test_unescape(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{src: "plain", want: "plain"},
+		{src: "%3A%3a1", want: "::1"},
+		{src: "100%", want: "100%"},
+		{src: "%zz%2", want: "%zz%2"},
+	}
+	for _, tt := range tests {
+		if got := string(unescape(nil, []byte(tt.src))); got != tt.want {
+			t.Errorf("unescape(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package esl
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// ErrNoRoute no route matches the outbound channel and NotFound is unset
+var ErrNoRoute = errors.New("esl: no outbound route matched")
+
+// OutboundMux route the outbound connections by the headers of the
+// CHANNEL_DATA reply, e.g. Caller-Destination-Number, Caller-Context and
+// Caller-Caller-ID-Number
+// the routes are tried in the order added, the first matched one is called
+// use Serve as Outbound.HandlerFunc
+type OutboundMux struct {
+	// NotFound func called when no route matches
+	// Default: nil, ErrNoRoute is returned
+	NotFound OutboundHandlerFunc
+
+	routes []*Route
+}
+
+// Route a handler called when all of its conditions match
+type Route struct {
+	conds   []condition
+	handler OutboundHandlerFunc
+}
+
+type condition struct {
+	header string
+	re     *regexp.Regexp
+	// names the capture names by the submatch index
+	names []string
+}
+
+// Handle add a route matching a header against the pattern
+// see Route.Match for the pattern syntax
+func (m *OutboundMux) Handle(header, pattern string, h OutboundHandlerFunc) {
+	m.Route().Match(header, pattern).Handle(h)
+}
+
+// HandleRegexp add a route matching a header against the regexp
+func (m *OutboundMux) HandleRegexp(header string, re *regexp.Regexp, h OutboundHandlerFunc) {
+	m.Route().MatchRegexp(header, re).Handle(h)
+}
+
+// Route add a route with several conditions, e.g.
+//
+//	mux.Route().
+//	    Match("Caller-Context", "public").
+//	    Match("Caller-Destination-Number", "800{ext}").
+//	    Handle(h)
+func (m *OutboundMux) Route() *Route {
+	r := &Route{}
+	m.routes = append(m.routes, r)
+	return r
+}
+
+// Match the header must match the pattern
+// the pattern is matched as a whole, "*" matches any characters, "?" matches
+// one character and "{name}" captures one or more characters as name,
+// which is read by Connection.Capture in the handler
+// the name is any text without "}", e.g. "1000", "1*", "+86{caller-id}"
+func (r *Route) Match(header, pattern string) *Route {
+	re, names := compilePattern(pattern)
+	r.conds = append(r.conds, condition{header: header, re: re, names: names})
+	return r
+}
+
+// MatchRegexp the header must match the regexp, the named groups are captured
+// e.g. regexp.MustCompile(`^9(?P<number>\d+)$`)
+func (r *Route) MatchRegexp(header string, re *regexp.Regexp) *Route {
+	r.conds = append(r.conds, condition{header: header, re: re, names: re.SubexpNames()})
+	return r
+}
+
+// Handle set the handler of the route
+func (r *Route) Handle(h OutboundHandlerFunc) {
+	r.handler = h
+}
+
+// match return the captures if all conditions match
+func (r *Route) match(info *Message) (map[string]string, bool) {
+	var captures map[string]string
+	for _, cond := range r.conds {
+		value := info.Header.Get(cond.header)
+		sub := cond.re.FindStringSubmatch(value)
+		if sub == nil {
+			return nil, false
+		}
+		for i, name := range cond.names {
+			if name == "" {
+				continue
+			}
+			if captures == nil {
+				captures = make(map[string]string)
+			}
+			captures[name] = sub[i]
+		}
+	}
+	return captures, true
+}
+
+// Serve call the handler of the first matched route
+func (m *OutboundMux) Serve(conn *Connection) error {
+	info := conn.Info()
+	if info != nil {
+		for _, r := range m.routes {
+			if r.handler == nil {
+				continue
+			}
+			if captures, ok := r.match(info); ok {
+				conn.captures = captures
+				return r.handler(conn)
+			}
+		}
+	}
+	if m.NotFound != nil {
+		return m.NotFound(conn)
+	}
+	return ErrNoRoute
+}
+
+// compilePattern convert the pattern to an anchored regexp, the captures are
+// unnamed groups as the names may be invalid in a regexp, names holds them by
+// the submatch index like regexp.SubexpNames
+func compilePattern(pattern string) (*regexp.Regexp, []string) {
+	var b strings.Builder
+	names := []string{""}
+	b.WriteByte('^')
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			b.WriteString(".*")
+			pattern = pattern[1:]
+			continue
+		case '?':
+			b.WriteByte('.')
+			pattern = pattern[1:]
+			continue
+		case '{':
+			if end := strings.IndexByte(pattern, '}'); end > 1 {
+				b.WriteString("(.+?)")
+				names = append(names, pattern[1:end])
+				pattern = pattern[end+1:]
+				continue
+			}
+		}
+		// the literal up to the next wildcard
+		end := strings.IndexAny(pattern[1:], "*?{") + 1
+		if end == 0 {
+			end = len(pattern)
+		}
+		b.WriteString(regexp.QuoteMeta(pattern[:end]))
+		pattern = pattern[end:]
+	}
+	b.WriteByte('$')
+	return regexp.MustCompile(b.String()), names
+}
@@ -0,0 +1,115 @@
+package esl
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func Test_compilePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{pattern: "1000", value: "1000", want: true},
+		{pattern: "1000", value: "10001", want: false},
+		{pattern: "1*", value: "1234", want: true},
+		{pattern: "1?", value: "12", want: true},
+		{pattern: "1?", value: "123", want: false},
+		{pattern: "+86{number}", value: "+8613800000000", want: true},
+		{pattern: "+86{number}", value: "+86", want: false},
+		{pattern: "a.b", value: "axb", want: false},
+		{pattern: "{", value: "{", want: true},
+		{pattern: "800{caller-id}", value: "8001", want: true},
+		{pattern: "{a(b}*", value: "x", want: true},
+	}
+	for _, tt := range tests {
+		re, _ := compilePattern(tt.pattern)
+		if got := re.MatchString(tt.value); got != tt.want {
+			t.Errorf("compilePattern(%q) match %q = %v, want %v", tt.pattern, tt.value, got, tt.want)
+		}
+	}
+
+	re, names := compilePattern("{country}-{caller-id}")
+	sub := re.FindStringSubmatch("86-1000")
+	if len(sub) != len(names) || names[1] != "country" || sub[1] != "86" || names[2] != "caller-id" || sub[2] != "1000" {
+		t.Errorf("compilePattern() captures = %q %q", names, sub)
+	}
+}
+
+func TestOutboundMux_Serve(t *testing.T) {
+	var mux OutboundMux
+	var got string
+	mux.Route().
+		Match("Caller-Context", "public").
+		Match("Caller-Destination-Number", "800{ext-number}").
+		Handle(func(conn *Connection) error {
+			got = "public " + conn.Capture("ext-number")
+			return nil
+		})
+	mux.Handle("Caller-Destination-Number", "800*", func(conn *Connection) error {
+		got = "default"
+		return nil
+	})
+	mux.HandleRegexp("Caller-Caller-ID-Number", regexp.MustCompile(`^9(?P<number>\d+)$`), func(conn *Connection) error {
+		got = "caller " + conn.Capture("number")
+		return nil
+	})
+
+	tests := []struct {
+		name        string
+		channelData string
+		want        string
+		wantErr     error
+	}{
+		{
+			name:        "all conditions",
+			channelData: "Caller-Context: public\nCaller-Destination-Number: 8001\n\n",
+			want:        "public 1",
+		},
+		{
+			name:        "first route not matched",
+			channelData: "Caller-Context: default\nCaller-Destination-Number: 8001\n\n",
+			want:        "default",
+		},
+		{
+			name:        "regexp",
+			channelData: "Caller-Destination-Number: 1000\nCaller-Caller-ID-Number: 9123\n\n",
+			want:        "caller 123",
+		},
+		{
+			name:        "no route",
+			channelData: "Caller-Destination-Number: 1000\n\n",
+			wantErr:     ErrNoRoute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := parseMessage(bufio.NewReader(strings.NewReader(tt.channelData)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ReleaseMessage(msg)
+			got = ""
+			c := &Connection{channelData: msg}
+			if err := mux.Serve(c); err != tt.wantErr {
+				t.Fatalf("Serve() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("handled = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	mux.NotFound = func(conn *Connection) error {
+		got = "not found"
+		return nil
+	}
+	msg, _ := parseMessage(bufio.NewReader(strings.NewReader("Caller-Destination-Number: 1000\n\n")))
+	defer ReleaseMessage(msg)
+	if err := mux.Serve(&Connection{channelData: msg}); err != nil || got != "not found" {
+		t.Errorf("Serve() = %v, handled %q, want NotFound", err, got)
+	}
+}
@@ -1,26 +1,100 @@
 package esl
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net"
+	"runtime/debug"
+	"sync"
+	"time"
 )
 
 const (
-	defaultLocalAddr = ":9090"
+	defaultLocalAddr   = ":9090"
+	defaultHangupCause = "NORMAL_TEMPORARY_FAILURE"
 )
 
+// ErrServerClosed returned by Serve after Shutdown or Close
+var ErrServerClosed = errors.New("esl: outbound server closed")
+
 type OutboundHandler func(conn *Connection)
 
+// OutboundHandlerFunc is like OutboundHandler but returns an error, see
+// Outbound.HangupOnError
+type OutboundHandlerFunc func(conn *Connection) error
+
+// ConnState the state of an outbound connection, see Outbound.ConnState
+type ConnState uint8
+
+const (
+	// StateNew the connection is accepted, before connect
+	StateNew ConnState = iota
+	// StateActive the channel data is received, Handler is called
+	StateActive
+	// StateClosed the connection is closed
+	StateClosed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateNew:
+		return "new"
+	case StateActive:
+		return "active"
+	case StateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
 type Outbound struct {
 	// LocalAddr the bind address for outbound socket
 	// default: ":9090"
 	LocalAddr string
 	// Handler handle the new Outbound connection
+	// one of Handler and HandlerFunc is required, HandlerFunc is preferred
 	Handler OutboundHandler
+	// HandlerFunc handle the new Outbound connection and report the failure
+	HandlerFunc OutboundHandlerFunc
+	// HangupOnError hang up the channel if the handler returns an error or
+	// panics, the panic is always recovered and logged
+	// Default: false
+	HangupOnError bool
+	// HangupCause the hangup cause of HangupOnError
+	// Default: "NORMAL_TEMPORARY_FAILURE"
+	HangupCause string
+	// Apps event handlers
+	// OnReconnect is not used by Outbound
+	Apps Applications
+	// ConnState func called when a connection changes state
+	ConnState func(conn net.Conn, state ConnState)
+
+	// The options below are sent after connected, before Handler is called
+
+	// MyEvents subscribe to the events of the controlled channel in the format
+	// Default: 0, not subscribed
+	MyEvents EventFormat
+	// DivertEvents redirect the events of input callbacks to the socket
+	DivertEvents bool
+	// Linger keep the socket open after the channel hangs up
+	Linger bool
+	// LingerTime linger duration, 0 means FreeSWITCH default
+	LingerTime time.Duration
+
+	// internal
+	mu        sync.Mutex
+	closed    bool
+	forced    bool
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	active    sync.WaitGroup
 }
 
+// Serve listen on LocalAddr and serve the outbound connections
 func (o *Outbound) Serve() error {
-	if o.Handler == nil {
+	if o.Handler == nil && o.HandlerFunc == nil {
 		return errors.New("unset outbound handler")
 	}
 
@@ -32,27 +106,258 @@ func (o *Outbound) Serve() error {
 	if err != nil {
 		return err
 	}
+	return o.ServeListener(l)
+}
+
+// ServeListener serve the outbound connections accepted by l, e.g. a unix
+// socket or a systemd activated listener, l is closed when it returns
+func (o *Outbound) ServeListener(l net.Listener) error {
+	if o.Handler == nil && o.HandlerFunc == nil {
+		_ = l.Close()
+		return errors.New("unset outbound handler")
+	}
+	if !o.trackListener(l, true) {
+		_ = l.Close()
+		return ErrServerClosed
+	}
+	defer o.trackListener(l, false)
 	defer l.Close()
 
+	var delay time.Duration
 	for {
 		conn, err := l.Accept()
 		if err != nil {
-			logger.Printf("unable to accept new connection: %v", err)
-			continue
+			if o.isClosed() {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				// e.g. too many open files, back off like net/http
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+				logger.Printf("unable to accept new connection: %v, retrying in %v", err, delay)
+				time.Sleep(delay)
+				continue
+			}
+			return err
+		}
+		delay = 0
+		if !o.trackConn(conn, true) {
+			_ = conn.Close()
+			return ErrServerClosed
 		}
 		go o.handleOne(conn)
 	}
 }
 
 func (o *Outbound) handleOne(conn net.Conn) {
-	defer conn.Close()
+	defer o.active.Done()
+	defer func() {
+		_ = conn.Close()
+		o.trackConn(conn, false)
+		o.setState(conn, StateClosed)
+	}()
+	o.setState(conn, StateNew)
 	c := acquireConnection(conn, outbound)
+	c.apps = &o.Apps
 	if err := c.connect(); err != nil {
 		logger.Printf("unable to connect to freeswitch: %v", err)
 		releaseOutbound(c)
 		return
 	}
-	go o.Handler(c)
+	if o.isForced() {
+		// cut by Close while connecting
+		releaseOutbound(c)
+		return
+	}
+	c.setConnected()
+	o.setState(conn, StateActive)
+
+	// the handler owns the connection until it returns, the connection is
+	// recycled only after both the handler and the reader finish
+	handled := make(chan struct{})
+	go func() {
+		defer close(handled)
+		if err := o.setup(c); err != nil {
+			logger.Printf("unable to setup outbound session (uuid: %s): %v", c.channelUUID(), err)
+			_ = c.Close()
+			return
+		}
+		if err := o.handle(c); err != nil {
+			logger.Printf("outbound handler failed (uuid: %s): %v", c.channelUUID(), err)
+			o.hangup(c)
+		}
+	}()
 	c.waitMessage()
+	<-handled
 	releaseOutbound(c)
 }
+
+func (o *Outbound) setState(conn net.Conn, state ConnState) {
+	if o.ConnState != nil {
+		o.ConnState(conn, state)
+	}
+}
+
+func (o *Outbound) isClosed() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.closed
+}
+
+// isForced report whether Close is called
+func (o *Outbound) isForced() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.forced
+}
+
+// trackListener add or remove the listener, false if the server is closed
+func (o *Outbound) trackListener(l net.Listener, add bool) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !add {
+		delete(o.listeners, l)
+		return true
+	}
+	if o.closed {
+		return false
+	}
+	if o.listeners == nil {
+		o.listeners = make(map[net.Listener]struct{})
+	}
+	o.listeners[l] = struct{}{}
+	return true
+}
+
+// trackConn add the accepted connection as active or remove it, so Close can
+// cut it even before connect, false if the server is closed
+func (o *Outbound) trackConn(conn net.Conn, add bool) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !add {
+		delete(o.conns, conn)
+		return true
+	}
+	if o.closed {
+		return false
+	}
+	if o.conns == nil {
+		o.conns = make(map[net.Conn]struct{})
+	}
+	o.conns[conn] = struct{}{}
+	o.active.Add(1)
+	return true
+}
+
+// closeListeners stop accepting new connections
+func (o *Outbound) closeListeners() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.closed = true
+	var err error
+	for l := range o.listeners {
+		if e := l.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Shutdown stop accepting new connections and wait for the active handlers to
+// return, the calls in progress are not interrupted
+// if ctx is done first, ctx.Err() is returned and the handlers keep running,
+// call Close to cut them
+func (o *Outbound) Shutdown(ctx context.Context) error {
+	err := o.closeListeners()
+
+	done := make(chan struct{})
+	go func() {
+		o.active.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stop accepting new connections and close all active connections
+// without waiting for the handlers
+func (o *Outbound) Close() error {
+	err := o.closeListeners()
+
+	o.mu.Lock()
+	o.forced = true
+	for conn := range o.conns {
+		_ = conn.Close()
+	}
+	o.mu.Unlock()
+	return err
+}
+
+// handle call the handler, a panic is recovered as an error
+func (o *Outbound) handle(c *Connection) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Printf("outbound handler panic (uuid: %s): %v\n%s", c.channelUUID(), r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	if o.HandlerFunc != nil {
+		return o.HandlerFunc(c)
+	}
+	o.Handler(c)
+	return nil
+}
+
+// hangup hang up the channel after the handler failed, if HangupOnError
+func (o *Outbound) hangup(c *Connection) {
+	if !o.HangupOnError {
+		return
+	}
+	select {
+	case <-c.Done():
+		// already hung up
+		return
+	default:
+	}
+	cause := o.HangupCause
+	if cause == "" {
+		cause = defaultHangupCause
+	}
+	reply := c.Hangup(cause)
+	if err := reply.Err(); err != nil {
+		logger.Printf("unable to hangup (uuid: %s): %v", c.channelUUID(), err)
+	}
+	if reply.Message != nil {
+		ReleaseMessage(reply.Message)
+	}
+}
+
+// setup send the session options
+func (o *Outbound) setup(c *Connection) error {
+	if o.MyEvents != 0 {
+		reply := c.MyEvents(o.MyEvents, "")
+		if err := reply.Err(); err != nil {
+			return err
+		}
+	}
+	if o.DivertEvents {
+		reply := c.DivertEvents(true)
+		if err := reply.Err(); err != nil {
+			return err
+		}
+	}
+	if o.Linger {
+		reply := c.Linger(o.LingerTime)
+		if err := reply.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
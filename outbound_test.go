@@ -0,0 +1,321 @@
+package esl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// dialOutbound act as FreeSWITCH: dial the outbound server, answer connect
+// with the channel data and reply each command with +OK
+func dialOutbound(t *testing.T, addr string, channelData string) net.Conn {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		r := bufio.NewReader(conn)
+		if _, err := readCommand(r); err != nil {
+			return
+		}
+		_, _ = conn.Write([]byte("Content-Type: command/reply\nReply-Text: +OK\n" + channelData + "\n"))
+		for {
+			if _, err := readCommand(r); err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("Content-Type: command/reply\nReply-Text: +OK\n\n"))
+		}
+	}()
+	return conn
+}
+
+func TestOutbound_Shutdown(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	o := &Outbound{Handler: func(conn *Connection) {
+		close(started)
+		<-release
+	}}
+	served := make(chan error, 1)
+	go func() { served <- o.ServeListener(l) }()
+
+	conn := dialOutbound(t, l.Addr().String(), "Unique-ID: a1\n")
+	defer conn.Close()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := o.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	select {
+	case err := <-served:
+		if err != ErrServerClosed {
+			t.Errorf("ServeListener() error = %v, want %v", err, ErrServerClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServeListener() is not stopped")
+	}
+	if _, err := net.Dial("tcp", l.Addr().String()); err == nil {
+		t.Errorf("new connection accepted after Shutdown")
+	}
+
+	close(release)
+	_ = conn.Close()
+	if err := o.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+}
+
+func TestOutbound_Close(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan *Connection, 1)
+	o := &Outbound{Handler: func(conn *Connection) {
+		started <- conn
+	}}
+	go func() { _ = o.ServeListener(l) }()
+
+	conn := dialOutbound(t, l.Addr().String(), "Unique-ID: a1\n")
+	defer conn.Close()
+	<-started
+
+	if err := o.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	// the socket is closed by the server
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Errorf("connection is not closed")
+	}
+	if err := o.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+}
+
+// pipeListener an in-memory listener, Dial return the FreeSWITCH side
+type pipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func (l *pipeListener) Close() error {
+	select {
+	case <-l.done:
+	default:
+		close(l.done)
+	}
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: "pipe", Net: "pipe"}
+}
+
+func (l *pipeListener) Dial() net.Conn {
+	server, client := net.Pipe()
+	l.conns <- server
+	return client
+}
+
+func TestOutbound_ServeListener(t *testing.T) {
+	l := newPipeListener()
+	var (
+		mu     sync.Mutex
+		states []ConnState
+	)
+	closed := make(chan struct{})
+	o := &Outbound{
+		Handler: func(conn *Connection) {
+			_ = conn.Close()
+		},
+		ConnState: func(conn net.Conn, state ConnState) {
+			mu.Lock()
+			states = append(states, state)
+			mu.Unlock()
+			if state == StateClosed {
+				close(closed)
+			}
+		},
+	}
+	served := make(chan error, 1)
+	go func() { served <- o.ServeListener(l) }()
+
+	conn := l.Dial()
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	if cmd, err := readCommand(r); err != nil || cmd != "connect\n" {
+		t.Fatalf("readCommand() = %q, %v", cmd, err)
+	}
+	_, _ = conn.Write([]byte("Content-Type: command/reply\nReply-Text: +OK\nUnique-ID: a1\n\n"))
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection is not closed")
+	}
+	mu.Lock()
+	got := fmt.Sprint(states)
+	mu.Unlock()
+	if want := "[new active closed]"; got != want {
+		t.Errorf("states = %s, want %s", got, want)
+	}
+
+	if err := o.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	if err := <-served; err != ErrServerClosed {
+		t.Errorf("ServeListener() error = %v, want %v", err, ErrServerClosed)
+	}
+}
+
+func TestOutbound_handlerLifecycle(t *testing.T) {
+	l := newPipeListener()
+	events := make(chan string, 1)
+	result := make(chan string, 1)
+	closed := make(chan struct{})
+	o := &Outbound{
+		Handler: func(conn *Connection) {
+			<-conn.Done()
+			if conn.Context().Err() == nil {
+				t.Errorf("Context() is not canceled after Done")
+			}
+			// the event after hangup is still received with linger
+			<-events
+			result <- conn.Info().Header.Get("Unique-ID")
+		},
+		Apps: Applications{OnEvent: func(msg *Message) {
+			events <- msg.Header.Get("Event-Name")
+		}},
+		ConnState: func(conn net.Conn, state ConnState) {
+			if state == StateClosed {
+				close(closed)
+			}
+		},
+	}
+	go func() { _ = o.ServeListener(l) }()
+	defer o.Close()
+
+	conn := l.Dial()
+	r := bufio.NewReader(conn)
+	if _, err := readCommand(r); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = conn.Write([]byte("Content-Type: command/reply\nReply-Text: +OK\nUnique-ID: a1\n\n"))
+	notice := "Disconnected, goodbye.\n"
+	_, _ = conn.Write([]byte(fmt.Sprintf("Content-Type: text/disconnect-notice\nContent-Disposition: linger\nContent-Length: %d\n\n%s", len(notice), notice)))
+	event := "Event-Name: CHANNEL_HANGUP_COMPLETE\n\n"
+	_, _ = conn.Write([]byte(fmt.Sprintf("Content-Type: text/event-plain\nContent-Length: %d\n\n%s", len(event), event)))
+	// FreeSWITCH closes the socket after lingering, before the handler returns
+	_ = conn.Close()
+
+	select {
+	case got := <-result:
+		if got != "a1" {
+			t.Errorf("Info() Unique-ID = %q, want %q, the connection is recycled", got, "a1")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler is not finished")
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection is not closed")
+	}
+}
+
+func TestOutbound_HandlerFuncPanic(t *testing.T) {
+	l := newPipeListener()
+	o := &Outbound{
+		HandlerFunc: func(conn *Connection) error {
+			panic("boom")
+		},
+		HangupOnError: true,
+		HangupCause:   "CALL_REJECTED",
+	}
+	go func() { _ = o.ServeListener(l) }()
+	defer o.Close()
+
+	conn := l.Dial()
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	if _, err := readCommand(r); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = conn.Write([]byte("Content-Type: command/reply\nReply-Text: +OK\nUnique-ID: a1\n\n"))
+
+	cmd, err := readCommand(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "sendmsg\ncall-command: hangup\nhangup-cause: CALL_REJECTED\n"; cmd != want {
+		t.Errorf("command = %q, want %q", cmd, want)
+	}
+	_, _ = conn.Write([]byte("Content-Type: command/reply\nReply-Text: +OK\n\n"))
+}
+
+func TestOutbound_CloseBeforeConnect(t *testing.T) {
+	l := newPipeListener()
+	var (
+		mu     sync.Mutex
+		states []ConnState
+	)
+	accepted := make(chan struct{})
+	o := &Outbound{
+		Handler: func(conn *Connection) {
+			t.Errorf("handler called on a connection cut by Close")
+		},
+		ConnState: func(conn net.Conn, state ConnState) {
+			mu.Lock()
+			states = append(states, state)
+			mu.Unlock()
+			if state == StateNew {
+				close(accepted)
+			}
+		},
+	}
+	go func() { _ = o.ServeListener(l) }()
+
+	// the peer never answers connect
+	conn := l.Dial()
+	defer conn.Close()
+	<-accepted
+	if err := o.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := o.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	mu.Lock()
+	got := fmt.Sprint(states)
+	mu.Unlock()
+	if want := "[new closed]"; got != want {
+		t.Errorf("states = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,90 @@
+package esl
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// ReconnectStatus the result of a reconnect attempt
+type ReconnectStatus struct {
+	// Attempt the attempt number, starting from 1
+	Attempt int
+	// Delay the delay before the next attempt, 0 if reconnected or no more
+	// attempt is made
+	Delay time.Duration
+	// Err the error of the attempt, nil if reconnected
+	Err error
+	// RestoreErr the error of replaying the events, filters, log and myevents
+	// commands after reconnected, the failed ones are dropped
+	RestoreErr error
+}
+
+// ReconnectPolicy decide the delay and the dial timeout of reconnect attempts
+type ReconnectPolicy interface {
+	// Delay return the delay after the failed attempt, attempt starts from 1
+	Delay(attempt int) time.Duration
+	// DialTimeout return the dial timeout of the attempt
+	// 0 means Inbound.DialTimeout
+	DialTimeout(attempt int) time.Duration
+}
+
+// DefaultReconnectPolicy used if Inbound.ReconnectPolicy is not set
+var DefaultReconnectPolicy ReconnectPolicy = &BackoffPolicy{}
+
+const (
+	defaultBackoffInitial    = time.Second
+	defaultBackoffMax        = 30 * time.Second
+	defaultBackoffMultiplier = 2
+	defaultBackoffJitter     = 0.2
+)
+
+// BackoffPolicy exponential backoff with jitter
+// the zero value is ready to use: 1s, 2s, 4s ... 30s, with 20% jitter
+type BackoffPolicy struct {
+	// Initial the delay after the first failed attempt
+	// Default: 1s
+	Initial time.Duration
+	// Max the max delay
+	// Default: 30s
+	Max time.Duration
+	// Multiplier the delay is multiplied after each failed attempt
+	// Default: 2
+	Multiplier float64
+	// Jitter randomly reduce the delay by up to this fraction, in [0, 1]
+	// a negative value disables jitter
+	// Default: 0.2
+	Jitter float64
+	// Timeout the dial timeout of each attempt
+	// Default: 0, Inbound.DialTimeout
+	Timeout time.Duration
+}
+
+func (p *BackoffPolicy) Delay(attempt int) time.Duration {
+	initial, max, multiplier, jitter := p.Initial, p.Max, p.Multiplier, p.Jitter
+	if initial <= 0 {
+		initial = defaultBackoffInitial
+	}
+	if max <= 0 {
+		max = defaultBackoffMax
+	}
+	if multiplier < 1 {
+		multiplier = defaultBackoffMultiplier
+	}
+	if jitter == 0 {
+		jitter = defaultBackoffJitter
+	}
+
+	d := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if d > float64(max) {
+		d = float64(max)
+	}
+	if jitter > 0 {
+		d -= d * math.Min(jitter, 1) * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+func (p *BackoffPolicy) DialTimeout(int) time.Duration {
+	return p.Timeout
+}
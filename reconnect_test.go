@@ -0,0 +1,36 @@
+package esl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffPolicy_Delay(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  BackoffPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{name: "first", policy: BackoffPolicy{Jitter: -1}, attempt: 1, want: time.Second},
+		{name: "third", policy: BackoffPolicy{Jitter: -1}, attempt: 3, want: 4 * time.Second},
+		{name: "max", policy: BackoffPolicy{Jitter: -1}, attempt: 10, want: 30 * time.Second},
+		{name: "custom", policy: BackoffPolicy{Initial: 100 * time.Millisecond, Max: time.Second, Multiplier: 3, Jitter: -1}, attempt: 3, want: 900 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Delay(tt.attempt); got != tt.want {
+				t.Errorf("Delay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoffPolicy_DelayJitter(t *testing.T) {
+	p := &BackoffPolicy{Initial: time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if got := p.Delay(1); got < 500*time.Millisecond || got > time.Second {
+			t.Fatalf("Delay() = %v, want in [500ms, 1s]", got)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package esl
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// myEvents a myevents command applied by Connection.MyEvents
+type myEvents struct {
+	format EventFormat
+	uuid   string
+}
+
+func (m myEvents) command() *Command {
+	arg := m.format.String()
+	if m.uuid != "" {
+		arg = m.uuid + " " + arg
+	}
+	return AcquireCommand(MyEventsType).SetArg(arg)
+}
+
+func (c *Connection) addMyEvents(m myEvents) {
+	c.smu.Lock()
+	defer c.smu.Unlock()
+	for i, v := range c.myevents {
+		if v.uuid == m.uuid {
+			c.myevents[i] = m
+			return
+		}
+	}
+	c.myevents = append(c.myevents, m)
+}
+
+// clearSession forget the session state of the previous socket
+func (c *Connection) clearSession() {
+	c.smu.Lock()
+	c.filters = c.filters[:0]
+	c.sub = Subscription{}
+	c.logging = false
+	c.myevents = c.myevents[:0]
+	c.smu.Unlock()
+}
+
+// restore replay the successful filter, log, myevents and event commands on
+// the new socket, the failed ones are dropped from the session
+// the event command is the last, so no event arrives before the filters
+// ErrDisconnected is returned at once if the socket is lost again
+func (c *Connection) restore(ctx context.Context) error {
+	c.smu.Lock()
+	sub := Subscription{
+		Format:     c.sub.Format,
+		Events:     append([]string(nil), c.sub.Events...),
+		Subclasses: append([]string(nil), c.sub.Subclasses...),
+		Excluded:   append([]string(nil), c.sub.Excluded...),
+	}
+	filters := append([]Filter(nil), c.filters...)
+	logLevel, logging := c.logLevel, c.logging
+	myevents := append([]myEvents(nil), c.myevents...)
+	c.smu.Unlock()
+
+	var errs []string
+	replay := func(cmd *Command) (bool, error) {
+		reply := c.roundTrip(ctx, cmd)
+		releaseCommand(cmd)
+		if reply.err != nil {
+			return false, reply.err
+		}
+		if err := reply.Err(); err != nil {
+			errs = append(errs, err.Error())
+			return false, nil
+		}
+		return true, nil
+	}
+
+	for _, f := range filters {
+		ok, err := replay(AcquireCommand(FilterType).SetArg(f.Header + " " + f.Value))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			c.deleteFilter(f.Header, f.Value)
+		}
+	}
+	if logging {
+		ok, err := replay(AcquireCommand(LogType).SetArg(strconv.Itoa(logLevel)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			c.smu.Lock()
+			c.logging = false
+			c.smu.Unlock()
+		}
+	}
+	for _, m := range myevents {
+		ok, err := replay(m.command())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			c.removeMyEvents(m.uuid)
+		}
+	}
+
+	if !sub.Empty() {
+		ok, err := replay(AcquireCommand(EventType).SetArg(sub.Format.String() + " " + sub.Names()))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			c.smu.Lock()
+			c.sub = Subscription{}
+			c.smu.Unlock()
+		} else if len(sub.Excluded) > 0 {
+			ok, err = replay(AcquireCommand(NixEventType).SetArg(strings.Join(sub.Excluded, " ")))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				c.smu.Lock()
+				c.sub.Excluded = nil
+				c.smu.Unlock()
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("esl: failed to restore session: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (c *Connection) removeMyEvents(uuid string) {
+	c.smu.Lock()
+	defer c.smu.Unlock()
+	myevents := c.myevents[:0]
+	for _, m := range c.myevents {
+		if m.uuid != uuid {
+			myevents = append(myevents, m)
+		}
+	}
+	c.myevents = myevents
+}
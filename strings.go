@@ -7,9 +7,17 @@ const (
 	logData          = "log/data"
 	disconnectNotice = "text/disconnect-notice"
 	eventPlain       = "text/event-plain"
+	eventJSON        = "text/event-json"
+	eventXML         = "text/event-xml"
 	// rejected by acl
 	rudeRejection = "text/rude-rejection"
 
+	eventBackgroundJob   = "BACKGROUND_JOB"
+	eventHeartbeat       = "HEARTBEAT"
+	eventChannelCreate   = "CHANNEL_CREATE"
+	eventChannelDestroy  = "CHANNEL_DESTROY"
+	eventExecuteComplete = "CHANNEL_EXECUTE_COMPLETE"
+
 	replyOK  = "+OK"
 	replyERR = "-ERR"
 )
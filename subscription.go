@@ -0,0 +1,120 @@
+package esl
+
+import "strings"
+
+const (
+	eventCustom = "CUSTOM"
+	eventAll    = "ALL"
+)
+
+// Subscription the events subscribed by Connection.Event
+type Subscription struct {
+	// Format the format of the latest event command, 0 if nothing subscribed
+	Format EventFormat
+	// Events event names, e.g. CHANNEL_CREATE, ALL
+	Events []string
+	// Subclasses CUSTOM event subclasses, e.g. sofia::register
+	Subclasses []string
+	// Excluded event names unsubscribed by Connection.NixEvent while ALL is
+	// subscribed, they are sent by nixevent after the event command
+	Excluded []string
+}
+
+// Subscription return the events subscribed on the connection
+// Inbound subscribes them again after reconnected
+func (c *Connection) Subscription() Subscription {
+	c.smu.Lock()
+	defer c.smu.Unlock()
+	return Subscription{
+		Format:     c.sub.Format,
+		Events:     append([]string(nil), c.sub.Events...),
+		Subclasses: append([]string(nil), c.sub.Subclasses...),
+		Excluded:   append([]string(nil), c.sub.Excluded...),
+	}
+}
+
+// Names return the space separated names accepted by Connection.Event
+func (s Subscription) Names() string {
+	names := make([]string, 0, len(s.Events)+len(s.Subclasses)+1)
+	for _, name := range s.Events {
+		if name != eventCustom {
+			names = append(names, name)
+		}
+	}
+	if len(s.Subclasses) > 0 || contains(s.Events, eventCustom) {
+		names = append(names, eventCustom)
+		names = append(names, s.Subclasses...)
+	}
+	return strings.Join(names, " ")
+}
+
+// Empty report whether nothing is subscribed
+func (s Subscription) Empty() bool {
+	return len(s.Events) == 0 && len(s.Subclasses) == 0
+}
+
+// add record the names, FreeSWITCH treats the names after CUSTOM as subclasses
+func (s *Subscription) add(names []string) {
+	custom := false
+	for _, name := range names {
+		switch {
+		case custom:
+			if !contains(s.Subclasses, name) {
+				s.Subclasses = append(s.Subclasses, name)
+			}
+		case name == eventCustom:
+			custom = true
+			fallthrough
+		default:
+			if name == eventAll {
+				s.Excluded = nil
+			}
+			s.Excluded = without(s.Excluded, name)
+			if !contains(s.Events, name) {
+				s.Events = append(s.Events, name)
+			}
+		}
+	}
+}
+
+// remove forget the names, the names nixed from ALL are recorded as Excluded
+func (s *Subscription) remove(names []string) {
+	custom := false
+	for _, name := range names {
+		switch {
+		case custom:
+			s.Subclasses = without(s.Subclasses, name)
+		case name == eventAll:
+			// every event is unsubscribed
+			s.Events = nil
+			s.Excluded = nil
+		case name == eventCustom:
+			custom = true
+			s.Events = without(s.Events, name)
+		default:
+			s.Events = without(s.Events, name)
+			if contains(s.Events, eventAll) && !contains(s.Excluded, name) {
+				s.Excluded = append(s.Excluded, name)
+			}
+		}
+	}
+}
+
+func contains(names []string, name string) bool {
+	for _, v := range names {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+func without(names []string, name string) []string {
+	dst := names[:0]
+	for _, v := range names {
+		if v != name {
+			dst = append(dst, v)
+		}
+	}
+	return dst
+}
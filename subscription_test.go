@@ -0,0 +1,61 @@
+package esl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSubscription_Names(t *testing.T) {
+	tests := []struct {
+		name   string
+		add    string
+		remove string
+		want   string
+	}{
+		{name: "events", add: "CHANNEL_CREATE HEARTBEAT CHANNEL_CREATE", want: "CHANNEL_CREATE HEARTBEAT"},
+		{name: "custom", add: "CUSTOM sofia::register HEARTBEAT", want: "CUSTOM sofia::register HEARTBEAT"},
+		{name: "custom first", add: "HEARTBEAT CUSTOM sofia::register", want: "HEARTBEAT CUSTOM sofia::register"},
+		{name: "nix event", add: "CHANNEL_CREATE HEARTBEAT", remove: "HEARTBEAT", want: "CHANNEL_CREATE"},
+		{name: "nix subclass", add: "HEARTBEAT CUSTOM sofia::register sofia::expire", remove: "CUSTOM sofia::register", want: "HEARTBEAT CUSTOM sofia::expire"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s Subscription
+			s.add(strings.Fields(tt.add))
+			s.remove(strings.Fields(tt.remove))
+			if got := s.Names(); got != tt.want {
+				t.Errorf("Names() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscription_Excluded(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []string
+		want string
+	}{
+		{name: "nix from ALL", ops: []string{"+ALL", "-PRESENCE_IN CHANNEL_CALLSTATE"}, want: "PRESENCE_IN CHANNEL_CALLSTATE"},
+		{name: "subscribed again", ops: []string{"+ALL", "-PRESENCE_IN CHANNEL_CALLSTATE", "+PRESENCE_IN"}, want: "CHANNEL_CALLSTATE"},
+		{name: "ALL again", ops: []string{"+ALL", "-PRESENCE_IN", "+ALL"}, want: ""},
+		{name: "nix ALL", ops: []string{"+ALL HEARTBEAT", "-PRESENCE_IN", "-ALL"}, want: ""},
+		{name: "without ALL", ops: []string{"+HEARTBEAT", "-PRESENCE_IN"}, want: ""},
+		{name: "subclass", ops: []string{"+ALL", "-CUSTOM sofia::register"}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s Subscription
+			for _, op := range tt.ops {
+				if op[0] == '+' {
+					s.add(strings.Fields(op[1:]))
+				} else {
+					s.remove(strings.Fields(op[1:]))
+				}
+			}
+			if got := strings.Join(s.Excluded, " "); got != tt.want {
+				t.Errorf("Excluded = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}